@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/xbt573/flood-social-rep/database"
+	"github.com/xbt573/flood-social-rep/models"
+	"github.com/xbt573/flood-social-rep/webserver"
+	"golang.org/x/exp/slog"
+	"io"
+	"os"
+	"time"
+)
+
+// importLineMax is a maximum length of JSONL file line
+const importLineMax = 16 * 1024 * 1024
+
+// importChunk is a number of requests imported in one transaction
+const importChunk = 1000
+
+// importCooldowns is a number of keys replayed reactions cooldowns keep
+const importCooldowns = 100000
+
+// Import function replays JSONL file of forwarder requests (or webserver
+// capture records) into database as if they were sent to webserver
+// (captured ones at time they were received at):
+// import [-dry-run] [-no-cooldowns] <file>.
+// Malformed and failed requests are logged and skipped.
+// Returns non-nil error if something goes wrong.
+func Import(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only report what would change")
+	noCooldowns := flags.Bool("no-cooldowns", false, "don't rate limit replayed reactions")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		slog.Error("File is missing!", slog.String("usage", "import [-dry-run] [-no-cooldowns] <file>"))
+		return errors.New("file is missing")
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		slog.Error(
+			"Failed opening file!",
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+	defer file.Close()
+
+	store, err := database.Open(databaseDSN(), database.DefaultRegistry())
+	if err != nil {
+		slog.Error(
+			"Failed database init!",
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+	defer store.Close()
+
+	stats, err := importRequests(store, file, *dryRun, *noCooldowns)
+	if err != nil {
+		return err
+	}
+
+	message := "Imported!"
+	if *dryRun {
+		message = "Dry run, nothing is changed"
+	}
+
+	slog.Info(
+		message,
+		slog.Int("requests", stats.Requests),
+		slog.Int("applied", stats.Requests-stats.Failed),
+		slog.Int("failed", stats.Failed),
+		slog.Int("added", stats.Added),
+		slog.Int("removed", stats.Removed),
+		slog.Int("skipped", stats.Skipped),
+	)
+
+	return nil
+}
+
+// importStats are statistics of import
+type importStats struct {
+	webserver.IngestResult
+
+	// Requests is a number of requests replayed
+	Requests int
+
+	// Failed is a number of malformed and failed requests
+	Failed int
+}
+
+// importRequests function replays JSONL requests read from r into
+// store, streaming them in transactions of importChunk requests. Dry
+// run is streamed in single transaction, so its requests see changes of
+// all previous ones, as they would in real import.
+// Replayed reactions are rate limited by time they were received at, in
+// cooldowns of their own, so live reactions are not limited by them.
+// Returns import statistics, non-nil error if something goes wrong.
+func importRequests(store database.Store, r io.Reader, dryRun, noCooldowns bool) (importStats, error) {
+	var (
+		stats importStats
+
+		// line is a number of line request being run was read from
+		line  int
+		chunk int
+		done  bool
+
+		// replayed is a time request being run was received at, it's
+		// current time of replayed reactions cooldowns
+		replayed  time.Time
+		cooldowns database.CooldownStore
+	)
+
+	if !noCooldowns {
+		cooldowns = database.NewMemoryCooldowns(importCooldowns, func() time.Time {
+			return replayed
+		})
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, importLineMax)
+
+	// next reads request of next line, nil ends transaction
+	next := func() database.BatchItem {
+		if !dryRun && chunk == importChunk {
+			return nil
+		}
+
+		for scanner.Scan() {
+			line++
+
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+
+			chunk++
+
+			var request models.Request
+
+			// Malformed request fails on its own when it's run
+			receivedAt, parseErr := parseImported(scanner.Bytes(), &request)
+			if receivedAt.IsZero() {
+				receivedAt = time.Now()
+			}
+
+			return func(store database.Store) error {
+				if parseErr != nil {
+					return parseErr
+				}
+
+				replayed = receivedAt
+
+				result, err := webserver.Ingest(store, request, receivedAt)
+				if err != nil {
+					return err
+				}
+
+				stats.Added += result.Added
+				stats.Removed += result.Removed
+				stats.Skipped += result.Skipped
+
+				return nil
+			}
+		}
+
+		done = true
+		return nil
+	}
+
+	report := func(err error) {
+		stats.Requests++
+
+		if err == nil {
+			return
+		}
+
+		stats.Failed++
+
+		slog.Warn(
+			"Request failed",
+			slog.Int("line", line),
+			slog.String("err", err.Error()),
+		)
+	}
+
+	for !done {
+		chunk = 0
+
+		err := store.BatchStream(next, report, database.BatchOpts{
+			DryRun:      dryRun,
+			NoCooldowns: noCooldowns,
+			Cooldowns:   cooldowns,
+		})
+		if err != nil {
+			slog.Error(
+				"Failed importing requests!",
+				slog.Int("line", line),
+				slog.String("err", err.Error()),
+			)
+			return stats, err
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		slog.Error(
+			"Failed reading file!",
+			slog.String("err", err.Error()),
+		)
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// parseImported function parses line of imported file into request,
+// line is either request or capture record of it. Captured requests
+// rejected by webserver are not replayed.
+// Returns time captured request was received at (zero for plain
+// request), non-nil error if line is malformed or rejected.
+func parseImported(line []byte, request *models.Request) (time.Time, error) {
+	var record webserver.CaptureRecord
+
+	err := json.Unmarshal(line, &record)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if record.ReceivedAt.IsZero() {
+		return time.Time{}, json.Unmarshal(line, request)
+	}
+
+	if record.Status >= 400 && record.Status < 500 {
+		return record.ReceivedAt, fmt.Errorf("request was rejected with %v", record.Status)
+	}
+
+	if record.Request == nil {
+		return record.ReceivedAt, errors.New("captured body is not JSON")
+	}
+
+	return record.ReceivedAt, json.Unmarshal(record.Request, request)
+}
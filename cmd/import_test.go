@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/xbt573/flood-social-rep/database"
+	"github.com/xbt573/flood-social-rep/webserver"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// importFile is a function which builds JSONL file of more than
+// importChunk capture records: reactions to messages, some of them
+// taken back and repeated in later chunks, and malformed lines
+func importFile(t *testing.T) []byte {
+	t.Helper()
+
+	var file bytes.Buffer
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	record := func(messageId int64, givers ...int64) {
+		reactions := make([]any, 0, len(givers))
+		for _, giver := range givers {
+			reactions = append(reactions, map[string]any{
+				"emoji": "👍",
+				"from":  map[string]any{"id": giver},
+			})
+		}
+
+		request, err := json.Marshal(map[string]any{
+			"message_id": messageId,
+			"chat":       map[string]any{"id": -1001},
+			"from_user":  map[string]any{"id": 1, "first_name": "A"},
+			"reactions":  reactions,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line, err := json.Marshal(webserver.CaptureRecord{
+			ReceivedAt: at,
+			Status:     200,
+			Request:    request,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file.Write(append(line, '\n'))
+		at = at.Add(time.Second)
+	}
+
+	messages := int64(importChunk + importChunk/2)
+
+	for messageId := int64(1); messageId <= messages; messageId++ {
+		record(messageId, 2+messageId%5, 2+(messageId+1)%5)
+
+		if messageId%100 == 0 {
+			fmt.Fprintln(&file, "{malformed")
+		}
+	}
+
+	// Reactions of first chunk are taken back and given again in the
+	// last one
+	for messageId := int64(1); messageId <= 300; messageId++ {
+		record(messageId, 2+messageId%5)
+	}
+
+	for messageId := int64(1); messageId <= 100; messageId++ {
+		record(messageId, 2+messageId%5, 2+(messageId+1)%5)
+	}
+
+	return file.Bytes()
+}
+
+// Dry run statistics are the same as real import ones, even when file
+// spans many transactions
+func TestImportDryRun(t *testing.T) {
+	file := importFile(t)
+
+	for _, backend := range []string{"memory", "sqlite"} {
+		t.Run(backend, func(t *testing.T) {
+			dsn := "memory"
+			if backend == "sqlite" {
+				dsn = filepath.Join(t.TempDir(), "test.db")
+			}
+
+			store, err := database.Open(dsn, database.DefaultRegistry())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+
+			// Dry run leaves store as it was for real import
+			dryRun, err := importRequests(store, bytes.NewReader(file), true, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			imported, err := importRequests(store, bytes.NewReader(file), false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if dryRun != imported {
+				t.Errorf("dry run = %+v, import = %+v", dryRun, imported)
+			}
+
+			if imported.Removed == 0 || imported.Skipped == 0 || imported.Failed == 0 {
+				t.Errorf("import = %+v, want removed, skipped and failed requests", imported)
+			}
+		})
+	}
+}
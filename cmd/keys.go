@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/xbt573/flood-social-rep/database"
+	"github.com/xbt573/flood-social-rep/models"
+	"github.com/xbt573/flood-social-rep/webserver"
+	"golang.org/x/exp/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys function creates, revokes and lists webserver API keys:
+// keys create -chats <ids> [-expires <duration>], keys revoke <id>,
+// keys list [-chat <id>].
+// Returns non-nil error if something goes wrong.
+func Keys(args []string) error {
+	if len(args) == 0 {
+		slog.Error("Keys action is missing!", slog.String("usage", "keys create|revoke|list"))
+		return errors.New("keys action is missing")
+	}
+
+	store, err := database.Open(databaseDSN(), database.DefaultRegistry())
+	if err != nil {
+		slog.Error(
+			"Failed database init!",
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "create":
+		return createKey(store, args[1:])
+	case "revoke":
+		return revokeKey(store, args[1:])
+	case "list":
+		return listKeys(store, args[1:])
+	default:
+		slog.Error("Unknown keys action!", slog.String("name", args[0]))
+		return errors.New("unknown keys action")
+	}
+}
+
+// createKey function generates API key and prints its id and secret,
+// secret is not shown anywhere else.
+func createKey(store database.Store, args []string) error {
+	flags := flag.NewFlagSet("keys create", flag.ContinueOnError)
+	chats := flags.String("chats", "", "comma separated IDs of chats key is scoped to")
+	expires := flags.Duration("expires", 0, "time key is valid for (default is forever)")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	var chatIds []int64
+
+	for _, chat := range strings.Split(*chats, ",") {
+		if chat = strings.TrimSpace(chat); chat == "" {
+			continue
+		}
+
+		chatId, err := strconv.ParseInt(chat, 10, 64)
+		if err != nil {
+			slog.Error("Malformed chat ID!", slog.String("chat", chat))
+			return err
+		}
+
+		chatIds = append(chatIds, chatId)
+	}
+
+	if len(chatIds) == 0 {
+		slog.Error("Key must be scoped to at least one chat!")
+		return database.ErrNoKeyChats
+	}
+
+	key, err := webserver.NewAPIKey(chatIds, *expires)
+	if err != nil {
+		slog.Error(
+			"Failed generating key!",
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+
+	expiresAt := ""
+	if !key.ExpiresAt.IsZero() {
+		expiresAt = key.ExpiresAt.Format(time.RFC3339)
+	}
+
+	err = auditKey(store, database.AuditAPIKey, map[string]string{
+		"key":     key.Id,
+		"expires": expiresAt,
+	}, func(store database.Store) (models.APIKey, error) {
+		return key, store.AddAPIKey(key)
+	})
+	if err != nil {
+		slog.Error(
+			"Failed storing key!",
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+
+	fmt.Printf("id: %v\nsecret: %v\n", key.Id, key.Secret)
+
+	return nil
+}
+
+// revokeKey function removes API key, requests signed with it are
+// rejected right away.
+func revokeKey(store database.Store, args []string) error {
+	if len(args) != 1 {
+		slog.Error("Key ID is missing!", slog.String("usage", "keys revoke <id>"))
+		return errors.New("key id is missing")
+	}
+
+	err := auditKey(store, database.AuditUnAPIKey, map[string]string{
+		"key": args[0],
+	}, func(store database.Store) (models.APIKey, error) {
+		key, err := store.GetAPIKey(args[0])
+		if err != nil {
+			return models.APIKey{}, err
+		}
+
+		return key, store.RemoveAPIKey(key.Id)
+	})
+	if err != nil {
+		slog.Error(
+			"Failed revoking key!",
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+
+	slog.Info("Revoked!", slog.String("id", args[0]))
+
+	return nil
+}
+
+// auditKey function runs change of API key and records action into
+// audit log of every chat key is scoped to, in the same transaction.
+// Keys are managed from console, so entries have no actor.
+func auditKey(
+	store database.Store,
+	action string,
+	params map[string]string,
+	change func(store database.Store) (models.APIKey, error),
+) error {
+	errs, err := store.Batch([]database.BatchItem{func(store database.Store) error {
+		key, err := change(store)
+		if err != nil {
+			return err
+		}
+
+		for _, chatId := range key.ChatIds {
+			err := store.AddAudit(models.AuditEntry{
+				ChatId:    chatId,
+				Action:    action,
+				Params:    params,
+				CreatedAt: time.Now(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}}, database.BatchOpts{Atomic: true})
+	if len(errs) > 0 && errs[0] != nil {
+		return errs[0]
+	}
+
+	return err
+}
+
+// listKeys function prints API keys (of one chat if -chat is set)
+// without secrets.
+func listKeys(store database.Store, args []string) error {
+	flags := flag.NewFlagSet("keys list", flag.ContinueOnError)
+	chat := flags.Int64("chat", 0, "only list keys scoped to chat")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	keys, err := store.GetAPIKeys(*chat)
+	if err != nil {
+		slog.Error(
+			"Failed getting keys!",
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+
+	for _, key := range keys {
+		expires := "never"
+		if !key.ExpiresAt.IsZero() {
+			expires = key.ExpiresAt.Format(time.RFC3339)
+		}
+
+		var chats []string
+		for _, chatId := range key.ChatIds {
+			chats = append(chats, strconv.FormatInt(chatId, 10))
+		}
+
+		fmt.Printf(
+			"%v chats=%v created=%v expires=%v\n",
+			key.Id,
+			strings.Join(chats, ","),
+			key.CreatedAt.Format(time.RFC3339),
+			expires,
+		)
+	}
+
+	return nil
+}
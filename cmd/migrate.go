@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"flag"
+	"github.com/xbt573/flood-social-rep/database"
+	"golang.org/x/exp/slog"
+)
+
+// Migrate function reports database schema version and applies
+// (or reverts) migrations.
+// Returns non-nil error if something goes wrong.
+func Migrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	status := flags.Bool("status", false, "only report current schema version")
+	target := flags.Int("to", -1, "target schema version (default is latest)")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	migrator, err := database.OpenMigrator(databaseDSN())
+	if err != nil {
+		slog.Error(
+			"Failed opening database!",
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+	defer migrator.Close()
+
+	version, err := migrator.Version()
+	if err != nil {
+		slog.Error(
+			"Failed getting schema version!",
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+
+	slog.Info(
+		"Schema version",
+		slog.Int("current", version),
+		slog.Int("latest", migrator.Latest()),
+	)
+
+	if *status {
+		return nil
+	}
+
+	if *target == -1 {
+		*target = migrator.Latest()
+	}
+
+	err = migrator.Migrate(*target)
+	if err != nil {
+		slog.Error(
+			"Failed migrating database!",
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+
+	slog.Info("Migrated!", slog.Int("version", *target))
+
+	return nil
+}
@@ -13,16 +13,95 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Execute function runs subcommand selected by first argument,
+// bot and webserver are started if there is no subcommand.
+// Returns non-nil error if something goes wrong.
+func Execute(args []string) error {
+	if len(args) == 0 {
+		return Run()
+	}
+
+	switch args[0] {
+	case "migrate":
+		return Migrate(args[1:])
+	case "keys":
+		return Keys(args[1:])
+	case "import":
+		return Import(args[1:])
+	default:
+		slog.Error("Unknown subcommand!", slog.String("name", args[0]))
+		return errors.New("unknown subcommand")
+	}
+}
+
+// databaseDSN function returns database DSN from environment.
+func databaseDSN() string {
+	dsn, exists := os.LookupEnv("DATABASE")
+	if !exists {
+		return "./database.db"
+	}
+
+	return dsn
+}
+
+// Capture defaults: file size in megabytes and number of rotated files
+const (
+	captureMaxSize = 100
+	captureKeep    = 5
+)
+
+// envInt function returns non-negative integer environment variable,
+// fallback if it's unset.
+// Returns non-nil error if it's malformed.
+func envInt(name string, fallback int) (int, error) {
+	value, exists := os.LookupEnv(name)
+	if !exists {
+		return fallback, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err == nil && number < 0 {
+		err = errors.New("value is negative")
+	}
+	if err != nil {
+		slog.Error(
+			"Failed parsing "+name+"!",
+			slog.String("err", err.Error()),
+		)
+		return 0, err
+	}
+
+	return number, nil
+}
+
 // Run function runs Telegram bot and webserver.
 // Returns non-nil error if something goes wrong.
 func Run() error {
 	slog.Info("Starting flood-social-rep")
 
+	// Reaction categories, built-in unless configured
+	registry := database.DefaultRegistry()
+
+	if path, exists := os.LookupEnv("REACTION_MAP"); exists {
+		loaded, err := database.LoadRegistry(path)
+		if err != nil {
+			slog.Error(
+				"Failed loading reaction map!",
+				slog.String("err", err.Error()),
+			)
+			return err
+		}
+
+		registry = loaded
+	}
+
 	// Database initialization
-	err := database.Init()
+	store, err := database.Open(databaseDSN(), registry)
 	if err != nil {
 		slog.Error(
 			"Failed database init!",
@@ -30,6 +109,7 @@ func Run() error {
 		)
 		return err
 	}
+	defer store.Close()
 
 	// Looking up environment variables
 	token, exists := os.LookupEnv("BOT_TOKEN")
@@ -53,16 +133,69 @@ func Run() error {
 	}
 
 	key, exists := os.LookupEnv("KEY")
-	if !exists {
+	if !exists && keyEnabled {
 		slog.Warn("KEY variable does not exist!")
 	}
 
+	// Request signing keys, several are active during rotation
+	var signingKeys []string
+
+	for _, signingKey := range strings.Split(os.Getenv("SIGNING_KEYS"), ",") {
+		if signingKey = strings.TrimSpace(signingKey); signingKey != "" {
+			signingKeys = append(signingKeys, signingKey)
+		}
+	}
+
+	window := webserver.DefaultWindow
+
+	if windowStr, exists := os.LookupEnv("SIGNATURE_WINDOW"); exists {
+		window, err = time.ParseDuration(windowStr)
+		if err != nil {
+			slog.Error(
+				"Failed parsing SIGNATURE_WINDOW!",
+				slog.String("err", err.Error()),
+			)
+			return err
+		}
+	}
+
+	// Reactions requests capture, disabled unless file is set
+	var capture *webserver.Capture
+
+	if captureFile, exists := os.LookupEnv("CAPTURE_FILE"); exists && captureFile != "" {
+		maxSize, err := envInt("CAPTURE_MAX_SIZE", captureMaxSize)
+		if err != nil {
+			return err
+		}
+
+		keep, err := envInt("CAPTURE_KEEP", captureKeep)
+		if err != nil {
+			return err
+		}
+
+		capture, err = webserver.NewCapture(captureFile, int64(maxSize)*1024*1024, keep)
+		if err != nil {
+			slog.Error(
+				"Failed opening capture file!",
+				slog.String("err", err.Error()),
+			)
+			return err
+		}
+		defer capture.Close()
+	}
+
+	if len(signingKeys) == 0 && !keyEnabled {
+		slog.Warn("Webserver requests are not authenticated until API key is created!")
+	}
+
 	// Creating bot instance
 	bot, err := gotgbot.NewBot(token, &gotgbot.BotOpts{
-		Client: http.Client{},
-		DefaultRequestOpts: &gotgbot.RequestOpts{
-			Timeout: gotgbot.DefaultTimeout,
-			APIURL:  gotgbot.DefaultAPIURL,
+		BotClient: &gotgbot.BaseBotClient{
+			Client: http.Client{},
+			DefaultRequestOpts: &gotgbot.RequestOpts{
+				Timeout: gotgbot.DefaultTimeout,
+				APIURL:  gotgbot.DefaultAPIURL,
+			},
 		},
 	})
 
@@ -74,39 +207,46 @@ func Run() error {
 		return err
 	}
 
-	updater := ext.NewUpdater(&ext.UpdaterOpts{
-		Dispatcher: ext.NewDispatcher(&ext.DispatcherOpts{
-			// If an error is returned by a handler, log it and continue going.
-			Error: func(b *gotgbot.Bot, ctx *ext.Context, err error) ext.DispatcherAction {
-				slog.Error(
-					"error during processing!",
-					slog.String("err", err.Error()),
-				)
-				return ext.DispatcherActionNoop
-			},
-			MaxRoutines: ext.DefaultMaxRoutines,
-		}),
+	dispatcher := ext.NewDispatcher(&ext.DispatcherOpts{
+		// If an error is returned by a handler, log it and continue going.
+		Error: func(b *gotgbot.Bot, ctx *ext.Context, err error) ext.DispatcherAction {
+			slog.Error(
+				"error during processing!",
+				slog.String("err", err.Error()),
+			)
+			return ext.DispatcherActionNoop
+		},
+		MaxRoutines: ext.DefaultMaxRoutines,
 	})
 
+	updater := ext.NewUpdater(dispatcher, nil)
+
 	// Delegating handlers to handlers package
-	handlers.Handle(updater.Dispatcher)
+	handlers.Handle(dispatcher, store)
 
 	// Create webserver instance
-	app := webserver.New(key, keyEnabled)
+	app := webserver.New(store, webserver.NewAuth(store, signingKeys, window, key, keyEnabled), capture)
 
 	// errch is a channel for errors
 	errch := make(chan error)
 
 	// sigch is a channel for os interrupts
-	sigch := make(chan os.Signal)
+	sigch := make(chan os.Signal, 1)
 	signal.Notify(sigch, os.Interrupt)
 
 	go func() {
 		// Start bot
 		err := updater.StartPolling(bot, &ext.PollingOpts{
 			DropPendingUpdates: true,
-			GetUpdatesOpts: gotgbot.GetUpdatesOpts{
+			GetUpdatesOpts: &gotgbot.GetUpdatesOpts{
 				Timeout: 9,
+				// Reaction updates are not sent unless explicitly requested
+				AllowedUpdates: []string{
+					"message",
+					"message_reaction",
+					"message_reaction_count",
+					"callback_query",
+				},
 				RequestOpts: &gotgbot.RequestOpts{
 					Timeout: time.Second * 10,
 				},
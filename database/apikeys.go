@@ -0,0 +1,56 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/xbt573/flood-social-rep/models"
+)
+
+// API keys errors
+var (
+	ErrAPIKeyExists  = errors.New("api key already exists")
+	ErrUnknownAPIKey = errors.New("api key is unknown")
+	ErrNoKeyChats    = errors.New("api key has no chats")
+)
+
+// apiKeysQuery is a query of API keys rows read by scanAPIKeys
+const apiKeysQuery = `SELECT k.id, k.secret, k.created_at, k.expires_at, c.chat_id
+	FROM api_keys k JOIN api_key_chats c ON c.key_id=k.id`
+
+// scanAPIKeys is a function which reads API keys from rows of id,
+// secret, created_at, expires_at, chat_id (one row per key chat, rows
+// of key are adjacent)
+func scanAPIKeys(rows *sql.Rows) ([]models.APIKey, error) {
+	var keys []models.APIKey
+
+	for rows.Next() {
+		var (
+			key                  models.APIKey
+			createdAt, expiresAt int64
+			chatId               int64
+		)
+
+		err := rows.Scan(&key.Id, &key.Secret, &createdAt, &expiresAt, &chatId)
+		if err != nil {
+			return []models.APIKey{}, err
+		}
+
+		if last := len(keys) - 1; last >= 0 && keys[last].Id == key.Id {
+			keys[last].ChatIds = append(keys[last].ChatIds, chatId)
+			continue
+		}
+
+		key.ChatIds = []int64{chatId}
+		key.CreatedAt = seenTime(createdAt)
+		key.ExpiresAt = seenTime(expiresAt)
+
+		keys = append(keys, key)
+	}
+
+	err := rows.Err()
+	if err != nil {
+		return []models.APIKey{}, err
+	}
+
+	return keys, nil
+}
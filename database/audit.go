@@ -0,0 +1,80 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/xbt573/flood-social-rep/models"
+)
+
+// Audit actions
+const (
+	AuditIgnore      = "ignore"
+	AuditUnignore    = "unignore"
+	AuditModerator   = "moderator"
+	AuditUnmoderator = "unmoderator"
+	AuditAdjust      = "adjust"
+	AuditReset       = "reset"
+	AuditReactionMap = "reactionmap"
+	AuditWeight      = "weight"
+	AuditRateLimit   = "ratelimit"
+	AuditAPIKey      = "apikey"
+	AuditUnAPIKey    = "unapikey"
+)
+
+// encodeParams is a function which encodes audit entry params for
+// params column
+func encodeParams(params map[string]string) (string, error) {
+	if len(params) == 0 {
+		return "{}", nil
+	}
+
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+
+	return string(encoded), nil
+}
+
+// scanAudit is a function which reads audit entries from rows of
+// id, chat_id, actor_id, target_id, action, params, created_at
+func scanAudit(rows *sql.Rows) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+
+	for rows.Next() {
+		var (
+			entry     models.AuditEntry
+			params    string
+			createdAt int64
+		)
+
+		err := rows.Scan(
+			&entry.Id,
+			&entry.ChatId,
+			&entry.ActorId,
+			&entry.TargetId,
+			&entry.Action,
+			&params,
+			&createdAt,
+		)
+		if err != nil {
+			return []models.AuditEntry{}, err
+		}
+
+		err = json.Unmarshal([]byte(params), &entry.Params)
+		if err != nil {
+			return []models.AuditEntry{}, err
+		}
+
+		entry.CreatedAt = seenTime(createdAt)
+
+		entries = append(entries, entry)
+	}
+
+	err := rows.Err()
+	if err != nil {
+		return []models.AuditEntry{}, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrBatchAborted is an error of atomic batch which was rolled back
+// because one of its items failed, items after failed one are not run
+var ErrBatchAborted = errors.New("batch is rolled back")
+
+// BatchOpts are options of Store.Batch and Store.BatchStream
+type BatchOpts struct {
+	// Atomic makes whole batch roll back if any of its items fails,
+	// otherwise only changes of failed items are rolled back
+	Atomic bool
+
+	// DryRun makes batch roll back even if all of its items succeed,
+	// items still see changes made by previous ones
+	DryRun bool
+
+	// NoCooldowns makes reactions of batch bypass rate limiter
+	NoCooldowns bool
+
+	// Cooldowns makes reactions of batch be counted in these cooldowns
+	// instead of store ones (e.g. replayed reactions, which must not
+	// limit live ones). Its hits are not rolled back with batch.
+	Cooldowns CooldownStore
+}
+
+// BatchItem is a batch step, store it gets is bound to batch
+// transaction
+type BatchItem func(store Store) error
+
+// queryer is a connection pool or transaction queries are run in
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// transact is a function which runs fn in new transaction if db is
+// connection pool, or right in db if it's batch transaction already
+// (batch item savepoint rolls back changes of failed fn there)
+func transact(db queryer, fn func(tx queryer) error) error {
+	pool, ok := db.(*sql.DB)
+	if !ok {
+		return fn(db)
+	}
+
+	tx, err := pool.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// batchItems is a function which runs items in store batch stream,
+// it's Batch of every store
+func batchItems(store Store, items []BatchItem, opts BatchOpts) ([]error, error) {
+	errs := make([]error, 0, len(items))
+	next := 0
+
+	err := store.BatchStream(func() BatchItem {
+		if next == len(items) {
+			return nil
+		}
+
+		next++
+		return items[next-1]
+	}, func(err error) {
+		errs = append(errs, err)
+	}, opts)
+
+	if errors.Is(err, ErrBatchAborted) {
+		return errs, err
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return errs, nil
+}
+
+// runBatch is a function which runs items next returns with bound store
+// in tx, every item in its own savepoint, and commits tx (unless it's
+// dry run). Errors of items are passed to report. Returns
+// ErrBatchAborted if tx was rolled back because of them.
+func runBatch(tx *sql.Tx, bound Store, next func() BatchItem, report func(err error), opts BatchOpts) error {
+	failed := false
+
+	for item := next(); item != nil; item = next() {
+		if failed && opts.Atomic {
+			report(ErrBatchAborted)
+			continue
+		}
+
+		_, err := tx.Exec(`SAVEPOINT item`)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		itemErr := item(bound)
+
+		if itemErr != nil {
+			failed = true
+
+			// Savepoint is kept after rolling back to it
+			_, err = tx.Exec(`ROLLBACK TO SAVEPOINT item`)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+
+		_, err = tx.Exec(`RELEASE SAVEPOINT item`)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		report(itemErr)
+	}
+
+	if failed && opts.Atomic {
+		err := tx.Rollback()
+		if err != nil {
+			return err
+		}
+
+		return ErrBatchAborted
+	}
+
+	if opts.DryRun {
+		return tx.Rollback()
+	}
+
+	return tx.Commit()
+}
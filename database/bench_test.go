@@ -0,0 +1,108 @@
+package database
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchChat is a chat benchmarks work in
+const benchChat = -1001
+
+// benchSQLite is a function which opens SQLite store (WAL, prepared
+// statements) without rate limit in benchChat, filled with reactions
+// of users to each other
+func benchSQLite(b *testing.B, reactions int) *SQLite {
+	b.Helper()
+
+	store, err := NewSQLite(filepath.Join(b.TempDir(), "bench.db"), DefaultRegistry())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Cleanup(func() { store.Close() })
+
+	err = store.SetRateLimit(benchChat, RateLimit{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	like := ReactionKey("👍", "")
+
+	// Filled in single transaction, so setup doesn't take longer than
+	// benchmark itself
+	errs, err := store.Batch([]BatchItem{func(store Store) error {
+		for i := 0; i < reactions; i++ {
+			err := store.AddReaction(benchChat, int64(i%100+1000), int64(i%50+1), int64(i), like, time.Now())
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}}, BatchOpts{})
+	if err == nil {
+		err = errs[0]
+	}
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return store
+}
+
+func BenchmarkSQLiteAddReaction(b *testing.B) {
+	store := benchSQLite(b, 0)
+	like := ReactionKey("👍", "")
+
+	var messageId atomic.Int64
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := messageId.Add(1)
+
+			err := store.AddReaction(benchChat, id%100+1000, id%50+1, id, like, time.Now())
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkSQLiteTopRating(b *testing.B) {
+	store := benchSQLite(b, 10000)
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, err := store.TopRating(benchChat, AllTime)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkSQLiteGetUserRating(b *testing.B) {
+	store := benchSQLite(b, 10000)
+
+	var userId atomic.Int64
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, err := store.GetUserRating(benchChat, userId.Add(1)%50+1)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
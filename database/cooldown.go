@@ -0,0 +1,311 @@
+package database
+
+import (
+	"container/list"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Clock is a function which returns current time, it's replaced in
+// tests to control cooldowns
+type Clock func() time.Time
+
+// CooldownStore is a store of hits (reactions counted by rate limiter),
+// every hit is kept until it expires
+type CooldownStore interface {
+	// Hits returns number of not expired hits of key made since from
+	Hits(key string, from time.Time) (int, error)
+
+	// Hit registers hit of key at time, it's forgotten after expires
+	Hit(key string, at, expires time.Time) error
+
+	// Close closes store
+	Close() error
+}
+
+// cooldownHit is a hit kept in MemoryCooldowns
+type cooldownHit struct {
+	at      time.Time
+	expires time.Time
+}
+
+// cooldownEntry is a key hits kept in MemoryCooldowns
+type cooldownEntry struct {
+	key  string
+	hits []cooldownHit
+}
+
+// MemoryCooldowns is a CooldownStore which keeps hits in memory. Keys
+// without live hits are dropped, least recently used keys are evicted
+// when there are more than capacity of them.
+type MemoryCooldowns struct {
+	capacity int
+	clock    Clock
+
+	// entries are elements of order by key
+	entries map[string]*list.Element
+
+	// order is a list of entries, most recently used first
+	order *list.List
+
+	// mux is sync.Mutex which is locked where hits are accessed
+	mux sync.Mutex
+}
+
+// NewMemoryCooldowns is a function which creates MemoryCooldowns
+// keeping up to capacity keys
+func NewMemoryCooldowns(capacity int, clock Clock) *MemoryCooldowns {
+	return &MemoryCooldowns{
+		capacity: capacity,
+		clock:    clock,
+		entries:  map[string]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// Hits is a function which returns number of not expired hits of key
+// made since from
+func (c *MemoryCooldowns) Hits(key string, from time.Time) (int, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	element, exists := c.entries[key]
+	if !exists {
+		return 0, nil
+	}
+
+	if c.prune(element) {
+		return 0, nil
+	}
+
+	c.order.MoveToFront(element)
+
+	hits := 0
+	for _, hit := range element.Value.(*cooldownEntry).hits {
+		if !hit.at.Before(from) {
+			hits++
+		}
+	}
+
+	return hits, nil
+}
+
+// Hit is a function which registers hit of key at time
+func (c *MemoryCooldowns) Hit(key string, at, expires time.Time) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	element, exists := c.entries[key]
+	if !exists {
+		element = c.order.PushFront(&cooldownEntry{key: key})
+		c.entries[key] = element
+	}
+
+	entry := element.Value.(*cooldownEntry)
+	entry.hits = append(entry.hits, cooldownHit{at: at, expires: expires})
+
+	c.order.MoveToFront(element)
+
+	// Least recently used entry is stale most likely, so it's checked
+	// on every hit to keep memory clean without full scans
+	if back := c.order.Back(); back != element {
+		c.prune(back)
+	}
+
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+
+	return nil
+}
+
+// Close is a function which closes store, nothing to do here
+func (c *MemoryCooldowns) Close() error {
+	return nil
+}
+
+// unhit is a function which drops hit of key made at time, rolled back
+// batch drops hits of its reactions with it
+func (c *MemoryCooldowns) unhit(key string, at time.Time) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	element, exists := c.entries[key]
+	if !exists {
+		return
+	}
+
+	entry := element.Value.(*cooldownEntry)
+
+	for i := len(entry.hits) - 1; i >= 0; i-- {
+		if entry.hits[i].at.Equal(at) {
+			entry.hits = append(entry.hits[:i], entry.hits[i+1:]...)
+			break
+		}
+	}
+
+	if len(entry.hits) == 0 {
+		c.remove(element)
+	}
+}
+
+// prune is a function which drops expired hits of element, element is
+// removed if nothing is left. Reports whether element was removed.
+func (c *MemoryCooldowns) prune(element *list.Element) bool {
+	entry := element.Value.(*cooldownEntry)
+	now := c.clock()
+
+	var hits []cooldownHit
+	for _, hit := range entry.hits {
+		if now.Before(hit.expires) {
+			hits = append(hits, hit)
+		}
+	}
+
+	if len(hits) == 0 {
+		c.remove(element)
+		return true
+	}
+
+	entry.hits = hits
+
+	return false
+}
+
+// remove is a function which drops element with its hits
+func (c *MemoryCooldowns) remove(element *list.Element) {
+	delete(c.entries, element.Value.(*cooldownEntry).key)
+	c.order.Remove(element)
+}
+
+// cooldownSweep is a number of hits after which expired hits are
+// deleted from database
+const cooldownSweep = 100
+
+// SQLCooldowns is a CooldownStore which keeps hits in database, so
+// cooldowns survive restarts
+type SQLCooldowns struct {
+	clock Clock
+
+	// writes is a number of hits since last sweep
+	writes int
+
+	// Prepared statements
+	hits   *sql.Stmt
+	hit    *sql.Stmt
+	expire *sql.Stmt
+
+	// mux is sync.Mutex which is locked where writes are counted
+	mux sync.Mutex
+}
+
+// cooldownQueries are SQLCooldowns queries per dialect
+var cooldownQueries = map[string][3]string{
+	"sqlite": {
+		`SELECT COUNT(*) FROM cooldowns WHERE key=? AND at>=? AND expires>?`,
+		`INSERT INTO cooldowns VALUES(?, ?, ?)`,
+		`DELETE FROM cooldowns WHERE expires<=?`,
+	},
+	"postgres": {
+		`SELECT COUNT(*) FROM cooldowns WHERE key=$1 AND at>=$2 AND expires>$3`,
+		`INSERT INTO cooldowns VALUES($1, $2, $3)`,
+		`DELETE FROM cooldowns WHERE expires<=$1`,
+	},
+}
+
+// NewSQLCooldowns is a function which creates SQLCooldowns keeping hits
+// in cooldowns table of migrated db of dialect (sqlite or postgres)
+func NewSQLCooldowns(db *sql.DB, dialect string, clock Clock) (*SQLCooldowns, error) {
+	c := &SQLCooldowns{clock: clock}
+	queries := cooldownQueries[dialect]
+
+	statements := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&c.hits, queries[0]},
+		{&c.hit, queries[1]},
+		{&c.expire, queries[2]},
+	}
+
+	for _, x := range statements {
+		stmt, err := db.Prepare(x.query)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+
+		*x.stmt = stmt
+	}
+
+	return c, nil
+}
+
+// bind is a function which returns cooldowns keeping hits in tx
+func (c *SQLCooldowns) bind(tx *sql.Tx) *SQLCooldowns {
+	return &SQLCooldowns{
+		clock:  c.clock,
+		hits:   tx.Stmt(c.hits),
+		hit:    tx.Stmt(c.hit),
+		expire: tx.Stmt(c.expire),
+	}
+}
+
+// Hits is a function which returns number of not expired hits of key
+// made since from
+func (c *SQLCooldowns) Hits(key string, from time.Time) (int, error) {
+	var hits int
+
+	err := c.hits.QueryRow(key, from.UnixNano(), c.clock().UnixNano()).Scan(&hits)
+	if err != nil {
+		return 0, err
+	}
+
+	return hits, nil
+}
+
+// Hit is a function which registers hit of key at time, expired hits
+// are deleted every cooldownSweep hits
+func (c *SQLCooldowns) Hit(key string, at, expires time.Time) error {
+	_, err := c.hit.Exec(key, at.UnixNano(), expires.UnixNano())
+	if err != nil {
+		return err
+	}
+
+	c.mux.Lock()
+	c.writes++
+	sweep := c.writes >= cooldownSweep
+	if sweep {
+		c.writes = 0
+	}
+	c.mux.Unlock()
+
+	if !sweep {
+		return nil
+	}
+
+	_, err = c.expire.Exec(c.clock().UnixNano())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Close is a function which closes prepared statements, database is
+// owned by store
+func (c *SQLCooldowns) Close() error {
+	for _, stmt := range []*sql.Stmt{c.hits, c.hit, c.expire} {
+		if stmt == nil {
+			continue
+		}
+
+		err := stmt.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
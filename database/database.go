@@ -4,22 +4,21 @@ package database
 import (
 	"database/sql"
 	"errors"
-	_ "github.com/mattn/go-sqlite3" // side-effect import
 	"github.com/xbt573/flood-social-rep/models"
-	"golang.org/x/exp/maps"
 	"strings"
-	"sync"
 	"time"
 )
 
-// mux is sync.Mutex which is locked where database operation is pending
-var mux = sync.Mutex{}
+// Blacklist modes
+const (
+	// BlacklistReceive stops user from receiving rating
+	BlacklistReceive = "receive"
 
-var (
-	// attempts is a last users reaction attempts
-	attempts = map[int64]time.Time{}
-	// attemptsmux is a mutex for data race security
-	attemptsmux = sync.Mutex{}
+	// BlacklistGive stops user from giving rating
+	BlacklistGive = "give"
+
+	// BlacklistBoth stops user from both receiving and giving rating
+	BlacklistBoth = "both"
 )
 
 // Blacklist errors
@@ -28,472 +27,279 @@ var (
 	ErrNotInBlacklist     = errors.New("user is not in blacklist")
 )
 
-// Init is a function which initializes database for first time use
-// (if was not initialized before). Returns non-nil error if
-// something goes wrong!
-func Init() error {
-	mux.Lock()
-	defer mux.Unlock()
+// Moderators errors
+var (
+	ErrAlreadyModerator = errors.New("user is already moderator")
+	ErrNotModerator     = errors.New("user is not moderator")
+)
 
-	db, err := sql.Open("sqlite3", "./database.db")
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
-	sqlStmt := `
-		CREATE TABLE IF NOT EXISTS reactions(
-		    chat_id INTEGER NOT NULL,
-		    from_user_id INTEGER NOT NULL,
-		    user_id INTEGER NOT NULL,
-		    message_id INTEGER NOT NULL,
-		    reaction TEXT NOT NULL,
-		    
-		    PRIMARY KEY ( chat_id, from_user_id, user_id, message_id, reaction )
-		);
-
-		CREATE TABLE IF NOT EXISTS blacklist(
-			chat_id INTEGER NOT NULL,
-			user_id INTEGER NOT NULL  
-		);
-
-		CREATE TABLE IF NOT EXISTS username(
-		    user_id INTEGER NOT NULL,
-		    username TEXT NOT NULL
-		);
-	`
-
-	_, err = db.Exec(sqlStmt)
-	if err != nil {
-		return err
-	}
+// ErrUnknownMessage is returned when message author was never seen by bot
+// (or was seen longer than messageRetention ago)
+var ErrUnknownMessage = errors.New("message author is unknown")
 
-	return nil
-}
+// messageRetention is a time message authors are kept for since message
+// was last seen, reactions to older messages are not attributed
+const messageRetention = 30 * 24 * time.Hour
 
-// TopRating is a function which returns users rating
-func TopRating(chatId int64) ([]models.User, error) {
-	mux.Lock()
-	defer mux.Unlock()
+// messagePrune is a number of remembered messages which makes store
+// drop authors older than messageRetention
+const messagePrune = 1000
 
-	db, err := sql.Open("sqlite3", "./database.db")
-	if err != nil {
-		return []models.User{}, err
-	}
-	defer db.Close()
+// ErrUnknownUser is returned when user with username was never seen by bot
+var ErrUnknownUser = errors.New("user is unknown")
 
-	rows, err := db.Query(
-		`SELECT user_id, reaction FROM reactions WHERE chat_id=?`,
-		chatId,
-	)
-	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return []models.User{}, err
-		}
+// Store is an interface describing rating storage backend
+type Store interface {
+	// TopRating returns users rating for reactions received in window
+	TopRating(chatId int64, window Window) ([]models.User, error)
 
-		return []models.User{}, nil
-	}
+	// GetUserRating returns rating for specific user
+	GetUserRating(chatId, userId int64) (models.User, error)
 
-	usermap := map[int64]models.User{}
+	// AddReaction adds reaction made at time to store
+	AddReaction(chatId, fromUserId, userId, messageId int64, reaction string, at time.Time) error
 
-	for rows.Next() {
-		var userId int64
-		var reaction string
+	// RemoveReaction removes reaction from store
+	RemoveReaction(chatId, fromUserId, messageId int64, reaction string) error
 
-		err := rows.Scan(&userId, &reaction)
-		if err != nil {
-			return []models.User{}, err
-		}
+	// GetReactions returns reactions set on messageId in chatId
+	GetReactions(chatId, messageId int64) ([]models.Reaction, error)
 
-		if _, exists := usermap[userId]; !exists {
-			usermap[userId] = models.User{
-				UserId: userId,
-			}
-		}
+	// AddBlacklist adds user into chatId blacklist
+	AddBlacklist(chatId int64, entry models.BlacklistEntry) error
 
-		switch reaction {
-		case "👍": // Positive reactions
-			fallthrough
-		case "🔥":
-			fallthrough
-		case "❤":
-			fallthrough
-		case "❤‍🔥":
-			fallthrough
-		case "👏":
-			fallthrough
-		case "💯":
-			tmp := usermap[userId]
-			tmp.Likes++
-
-			usermap[userId] = tmp
-		case "🤡": // Negative reactions
-			fallthrough
-		case "💩":
-			fallthrough
-		case "🤮":
-			fallthrough
-		case "👎":
-			tmp := usermap[userId]
-			tmp.Dislikes++
-
-			usermap[userId] = tmp
-
-		case "🐳": // whale bruh
-			tmp := usermap[userId]
-			tmp.Whales++
-
-			usermap[userId] = tmp
-		}
-	}
+	// RemoveBlacklist removes user from chatId blacklist
+	RemoveBlacklist(chatId, userId int64) error
 
-	err = rows.Err()
-	if err != nil {
-		return []models.User{}, err
-	}
+	// GetBlacklist returns active (not expired) chatId blacklist entries
+	GetBlacklist(chatId int64) ([]models.BlacklistEntry, error)
 
-	return maps.Values(usermap), nil
-}
+	// AddModerator grants user bot moderation rights in chatId
+	AddModerator(chatId int64, moderator models.Moderator) error
 
-// GetUserRating is a function which returns rating for specific user.
-func GetUserRating(chatId, userId int64) (models.User, error) {
-	mux.Lock()
-	defer mux.Unlock()
+	// RemoveModerator revokes user bot moderation rights in chatId
+	RemoveModerator(chatId, userId int64) error
 
-	db, err := sql.Open("sqlite3", "./database.db")
-	if err != nil {
-		return models.User{}, err
-	}
-	defer db.Close()
+	// GetModerators returns chatId bot moderators
+	GetModerators(chatId int64) ([]models.Moderator, error)
 
-	rows, err := db.Query(
-		`SELECT reaction FROM reactions WHERE chat_id=? AND user_id=?`,
-		chatId,
-		userId,
-	)
-	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return models.User{}, err
-		}
+	// IsModerator reports whether userId is bot moderator in chatId
+	IsModerator(chatId, userId int64) (bool, error)
 
-		return models.User{
-			UserId: userId,
-		}, nil
-	}
+	// AddAdjustment records manual rating adjustment (or reset) of user
+	// in chatId, it's counted in ratings
+	AddAdjustment(chatId int64, adjustment models.Adjustment) error
 
-	var user models.User
+	// GetAdjustments returns up to limit latest adjustments of userId in
+	// chatId (of all users if userId is zero), most recent first
+	GetAdjustments(chatId, userId int64, limit int) ([]models.Adjustment, error)
 
-	for rows.Next() {
-		var reaction string
+	// AddAudit appends privileged action entry into audit log, entries
+	// are never changed or deleted
+	AddAudit(entry models.AuditEntry) error
 
-		err := rows.Scan(&reaction)
-		if err != nil {
-			return models.User{}, err
-		}
+	// GetAudit returns up to limit audit entries of chatId (of all chats
+	// if chatId is zero) with id less than before (any if before is
+	// zero), most recent first
+	GetAudit(chatId, before int64, limit int) ([]models.AuditEntry, error)
 
-		switch reaction {
-		case "👍": // Positive reactions
-			fallthrough
-		case "🔥":
-			fallthrough
-		case "❤":
-			fallthrough
-		case "❤‍🔥":
-			fallthrough
-		case "👏":
-			fallthrough
-		case "💯":
-			user.Likes++
-
-		case "🤡": // Negative reactions
-			fallthrough
-		case "💩":
-			fallthrough
-		case "🤮":
-			fallthrough
-		case "👎":
-			user.Dislikes++
-
-		case "🐳": // whale bruh
-			user.Whales++
-		}
-	}
+	// AddAPIKey stores webserver API key scoped to its chats
+	AddAPIKey(key models.APIKey) error
 
-	err = rows.Err()
-	if err != nil {
-		return models.User{}, err
-	}
+	// GetAPIKey returns API key by id, ErrUnknownAPIKey if there is none
+	GetAPIKey(id string) (models.APIKey, error)
 
-	return user, nil
-}
+	// GetAPIKeys returns API keys allowed to post reactions of chatId
+	// (all keys if chatId is zero)
+	GetAPIKeys(chatId int64) ([]models.APIKey, error)
 
-// AddReaction is a function which adds reaction to database
-func AddReaction(chatId, fromUserId, userId, messageId int64, reaction string) error {
-	// No karma for you, buddy
-	if userId == fromUserId {
-		return nil
-	}
+	// RemoveAPIKey revokes API key
+	RemoveAPIKey(id string) error
 
-	attemptsmux.Lock()
+	// AddName records username and full name userId was seen with in chatId
+	AddName(chatId, userId int64, username, fullName string, seen time.Time) error
 
-	attemptExists := false
-	for id, attempt := range attempts {
-		if userId != id {
-			continue
-		}
+	// GetNames returns names userId was seen with in chatId, most recent first
+	GetNames(chatId, userId int64) ([]models.Name, error)
 
-		attemptExists = true
-		attempts[id] = time.Now()
+	// GetLatestNames returns most recent names of userIds in chatId at once,
+	// users never seen are absent in result
+	GetLatestNames(chatId int64, userIds []int64) (map[int64]models.Name, error)
 
-		if time.Since(attempt) < time.Second*15 {
-			attemptsmux.Unlock()
-			return nil
-		}
-	}
+	// FindUser returns id of user last seen with username (case-insensitive)
+	// in chatId, ErrUnknownUser if there is no such user
+	FindUser(chatId int64, username string) (int64, error)
 
-	attemptsmux.Unlock()
+	// AddMessage remembers message author seen at time, authors are
+	// forgotten after messageRetention
+	AddMessage(chatId, messageId, userId int64, at time.Time) error
 
-	if !attemptExists {
-		attemptsmux.Lock()
-		attempts[userId] = time.Now()
-		attemptsmux.Unlock()
-	}
+	// GetMessageAuthor returns author of messageId in chatId
+	GetMessageAuthor(chatId, messageId int64) (int64, error)
 
-	mux.Lock()
-	defer mux.Unlock()
+	// GetReactionMap returns reaction -> category map used in chatId
+	GetReactionMap(chatId int64) (map[string]string, error)
 
-	db, err := sql.Open("sqlite3", "./database.db")
-	if err != nil {
-		return err
-	}
-	defer db.Close()
+	// SetReactionCategory overrides reaction category in chatId
+	SetReactionCategory(chatId int64, reaction, category string) error
 
-	row := db.QueryRow(
-		"SELECT * FROM blacklist WHERE chat_id=? AND user_id=?",
-		chatId,
-		userId,
-	)
+	// ResetReactionCategory drops chatId override of reaction category
+	ResetReactionCategory(chatId int64, reaction string) error
 
-	// dummy values
-	var a, b any = nil, nil
-	err = row.Scan(&a, &b)
-	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return err
-		}
-	} else {
-		// blacklist clause
-		return nil
-	}
+	// GetWeights returns category -> score weight map used in chatId
+	GetWeights(chatId int64) (map[string]float64, error)
 
-	_, err = db.Exec(
-		`INSERT INTO reactions VALUES(?, ?, ?, ?, ?)`,
-		chatId,
-		fromUserId,
-		userId,
-		messageId,
-		reaction,
-	)
+	// SetWeight overrides category score weight in chatId
+	SetWeight(chatId int64, category string, weight float64) error
 
-	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			// ignore constraint error 🐳
-			return nil
-		}
+	// ResetWeight drops chatId override of category score weight
+	ResetWeight(chatId int64, category string) error
 
-		return err
-	}
-
-	return nil
-}
+	// GetRateLimit returns reactions rate limit policy used in chatId
+	GetRateLimit(chatId int64) (RateLimit, error)
 
-// AddBlacklist is a function which adds user into blacklist
-func AddBlacklist(chatId, userId int64) error {
-	mux.Lock()
-	defer mux.Unlock()
-
-	db, err := sql.Open("sqlite3", "./database.db")
-	if err != nil {
-		return err
-	}
-	defer db.Close()
+	// SetRateLimit overrides reactions rate limit policy in chatId
+	SetRateLimit(chatId int64, policy RateLimit) error
 
-	row := db.QueryRow(
-		"SELECT * FROM blacklist WHERE chat_id=? AND user_id=?",
-		chatId,
-		userId,
-	)
+	// ResetRateLimit drops chatId override of reactions rate limit policy
+	ResetRateLimit(chatId int64) error
 
-	// dummy values
-	var a, b any = nil, nil
-	err = row.Scan(&a, &b)
-	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return err
-		}
-	} else {
-		return ErrAlreadyBlacklisted
-	}
+	// Batch runs items in single transaction, changes of failed items
+	// are rolled back. Returns errors of items, and ErrBatchAborted if
+	// whole batch was rolled back.
+	Batch(items []BatchItem, opts BatchOpts) ([]error, error)
 
-	_, err = db.Exec(`INSERT INTO blacklist VALUES(?, ?)`, chatId, userId)
-	if err != nil {
-		return err
-	}
+	// BatchStream runs items next returns (until it returns nil) in
+	// single transaction the same way as Batch, without keeping them.
+	// Error of every item is passed to report right after it's run.
+	// Returns ErrBatchAborted if whole batch was rolled back.
+	BatchStream(next func() BatchItem, report func(err error), opts BatchOpts) error
 
-	return nil
+	// Close releases store resources
+	Close() error
 }
 
-// RemoveBlacklist is a function which removes user from blacklist
-func RemoveBlacklist(chatId, userId int64) error {
-	mux.Lock()
-	defer mux.Unlock()
-
-	db, err := sql.Open("sqlite3", "./database.db")
-	if err != nil {
-		return err
+// Open is a function which opens Store selected by dsn:
+// "memory" for in-memory store, "postgres://..." for PostgreSQL,
+// anything else is treated as SQLite database file path.
+// Reactions are rated by registry mapping, unless chat overrides it.
+func Open(dsn string, registry *Registry) (Store, error) {
+	switch {
+	case dsn == "memory":
+		return NewMemory(registry), nil
+
+	case strings.HasPrefix(dsn, "postgres://"),
+		strings.HasPrefix(dsn, "postgresql://"):
+		return NewPostgres(dsn, registry)
+
+	default:
+		return NewSQLite(dsn, registry)
 	}
-	defer db.Close()
-
-	row := db.QueryRow(
-		"SELECT * FROM blacklist WHERE chat_id=? AND user_id=?",
-		chatId,
-		userId,
-	)
-
-	// dummy values
-	var a, b any = nil, nil
-	err = row.Scan(&a, &b)
-	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return err
-		}
+}
 
-		return ErrNotInBlacklist
+// count is a function which accounts reaction of category in user rating
+func count(user *models.User, category string) {
+	// Reaction is not rated
+	if category == "" {
+		return
 	}
 
-	_, err = db.Exec(
-		"DELETE FROM blacklist WHERE chat_id=? AND user_id=?",
-		chatId,
-		userId,
-	)
-	if err != nil {
-		return err
+	if user.Reactions == nil {
+		user.Reactions = map[string]int{}
 	}
 
-	return nil
+	user.Reactions[category]++
 }
 
-// UpdateUsername is a function which adds username into database
-// (used when getChatMember is fucked)
-func UpdateUsername(userId int64, username string) error {
-	mux.Lock()
-	defer mux.Unlock()
-
-	db, err := sql.Open("sqlite3", "./database.db")
-	if err != nil {
-		return err
+// adjust is a function which adds adjustment amount to user category count
+func adjust(user *models.User, category string, amount int) {
+	if user.Reactions == nil {
+		user.Reactions = map[string]int{}
 	}
-	defer db.Close()
 
-	row := db.QueryRow("SELECT * FROM username WHERE user_id=?", userId)
+	user.Reactions[category] += amount
+}
 
-	// dummy
-	var a, b any = nil, nil
-	err = row.Scan(&a, &b)
-	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return err
-		}
+// scanAdjustments is a function which reads adjustments from rows of
+// id, user_id, actor_id, category, amount, is_reset, reason, created_at
+func scanAdjustments(rows *sql.Rows) ([]models.Adjustment, error) {
+	var adjustments []models.Adjustment
 
-		_, err = db.Exec("INSERT INTO username VALUES(?, ?)", userId, username)
+	for rows.Next() {
+		var (
+			adjustment models.Adjustment
+			createdAt  int64
+		)
+
+		err := rows.Scan(
+			&adjustment.Id,
+			&adjustment.UserId,
+			&adjustment.ActorId,
+			&adjustment.Category,
+			&adjustment.Amount,
+			&adjustment.Reset,
+			&adjustment.Reason,
+			&createdAt,
+		)
 		if err != nil {
-			return err
+			return []models.Adjustment{}, err
 		}
 
-		return nil
+		adjustment.CreatedAt = seenTime(createdAt)
+
+		adjustments = append(adjustments, adjustment)
 	}
 
-	_, err = db.Exec(
-		"UPDATE username SET username=? WHERE user_id=?",
-		username,
-		userId,
-	)
+	err := rows.Err()
 	if err != nil {
-		return err
+		return []models.Adjustment{}, err
 	}
 
-	return nil
+	return adjustments, nil
 }
 
-// GetUsername is a function which gets username from database
-// (used when getChatMember is fucked)
-func GetUsername(userId int64) (string, error) {
-	mux.Lock()
-	defer mux.Unlock()
-
-	db, err := sql.Open("sqlite3", "./database.db")
-	if err != nil {
-		return "", err
-	}
-	defer db.Close()
-
-	row := db.QueryRow("SELECT username FROM username WHERE user_id=?", userId)
+// score is a function which calculates user net score from weights
+func score(user *models.User, weights map[string]float64) {
+	user.Score = 0
 
-	var username string
-	err = row.Scan(&username)
-	if err != nil {
-		return "", err
+	for category, reactions := range user.Reactions {
+		user.Score += float64(reactions) * weights[category]
 	}
-
-	return username, nil
 }
 
-// GetReactions is a function which returns reactions set on messageId in chatId
-func GetReactions(chatId, messageId int64) ([]models.Reaction, error) {
-	mux.Lock()
-	defer mux.Unlock()
-
-	db, err := sql.Open("sqlite3", "./database.db")
-	if err != nil {
-		return []models.Reaction{}, err
+// seenTime is a function which converts stored unix time into time,
+// zero stands for unknown time
+func seenTime(unix int64) time.Time {
+	if unix == 0 {
+		return time.Time{}
 	}
-	defer db.Close()
-
-	rows, err := db.Query(
-		"SELECT from_user_id, reaction FROM reactions WHERE chat_id=? AND message_id=?",
-		chatId,
-		messageId,
-	)
 
-	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return []models.Reaction{}, err
-		}
+	return time.Unix(unix, 0)
+}
 
-		return []models.Reaction{}, nil
+// unixTime is a function which converts time into stored unix time,
+// zero time is stored as zero
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
 	}
 
-	var reactions []models.Reaction
-
-	for rows.Next() {
-		var fromUserId int64
-		var reaction string
-
-		err := rows.Scan(&fromUserId, &reaction)
-		if err != nil {
-			return []models.Reaction{}, err
-		}
+	return t.Unix()
+}
 
-		reactions = append(reactions, models.Reaction{
-			UserId:   fromUserId,
-			Reaction: reaction,
-		})
+// unixNano is a function which converts time into stored unix time in
+// nanoseconds, it orders reactions with rating resets made in the same
+// second. Zero time is stored as zero.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
 	}
 
-	err = rows.Err()
-	if err != nil {
-		return []models.Reaction{}, err
-	}
+	return t.UnixNano()
+}
 
-	return reactions, nil
+// active is a function which reports whether blacklist entry is not
+// expired at now
+func active(entry models.BlacklistEntry, now time.Time) bool {
+	return entry.ExpiresAt.IsZero() || now.Before(entry.ExpiresAt)
 }
@@ -0,0 +1,1025 @@
+package database
+
+import (
+	"github.com/xbt573/flood-social-rep/models"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reactionKey is a reactions table primary key
+type reactionKey struct {
+	ChatId     int64
+	FromUserId int64
+	UserId     int64
+	MessageId  int64
+	Reaction   string
+}
+
+// chatUser is a pair of chat and user ids
+type chatUser struct {
+	ChatId int64
+	UserId int64
+}
+
+// memoryMessage is a message author kept in Memory
+type memoryMessage struct {
+	userId int64
+	seenAt time.Time
+}
+
+// chatMessage is a pair of chat and message ids
+type chatMessage struct {
+	ChatId    int64
+	MessageId int64
+}
+
+// nameKey is a names table primary key
+type nameKey struct {
+	ChatId   int64
+	UserId   int64
+	Username string
+	FullName string
+}
+
+// reset is a latest rating reset of user
+type reset struct {
+	id int64
+	at time.Time
+}
+
+// resets is a user id -> latest rating reset map
+type resets map[int64]reset
+
+// reaction is a function which reports whether reaction userId got at
+// time is counted, i.e. it's made after user rating reset
+func (r resets) reaction(userId int64, at time.Time) bool {
+	last, exists := r[userId]
+	return !exists || at.After(last.at)
+}
+
+// adjustment is a function which reports whether adjustment of userId
+// with id is counted, i.e. it's made after user rating reset
+func (r resets) adjustment(userId, id int64) bool {
+	last, exists := r[userId]
+	return !exists || id > last.id
+}
+
+// memoryData is a Memory data, it's shared by store and stores bound to
+// its batches
+type memoryData struct {
+	reactions  map[reactionKey]time.Time
+	blacklist  map[chatUser]models.BlacklistEntry
+	moderators map[chatUser]models.Moderator
+	names      map[nameKey]models.Name
+	messages   map[chatMessage]memoryMessage
+	overrides  map[int64]map[string]string
+	weights    map[int64]map[string]float64
+	limits     map[int64]RateLimit
+	apiKeys    map[string]models.APIKey
+
+	// adjustments are chat adjustments in order they were made,
+	// adjustmentId is the last adjustment id
+	adjustments  map[int64][]models.Adjustment
+	adjustmentId int64
+
+	// audit is an audit log in order entries were added, auditId is
+	// the last entry id
+	audit   []models.AuditEntry
+	auditId int64
+
+	// added is a number of remembered messages, old ones are pruned
+	// every messagePrune of them
+	added int
+
+	// mux is sync.Mutex which is locked where store operation is pending
+	mux sync.Mutex
+}
+
+// Memory is a Store which keeps everything in memory, useful for tests
+type Memory struct {
+	*memoryData
+
+	// registry is a default reaction mapping
+	registry *Registry
+
+	// limiter is a reactions rate limiter, it keeps hits in cooldowns
+	limiter   *Limiter
+	cooldowns *MemoryCooldowns
+
+	// batch is a change log of batch store is bound to, nil outside of
+	// batch
+	batch *memoryBatch
+}
+
+// NewMemory is a function which creates empty in-memory store
+func NewMemory(registry *Registry) *Memory {
+	cooldowns := NewMemoryCooldowns(cooldownCapacity, time.Now)
+
+	return &Memory{
+		registry:  registry,
+		limiter:   NewLimiter(cooldowns),
+		cooldowns: cooldowns,
+
+		memoryData: &memoryData{
+			reactions:  map[reactionKey]time.Time{},
+			blacklist:  map[chatUser]models.BlacklistEntry{},
+			moderators: map[chatUser]models.Moderator{},
+			names:      map[nameKey]models.Name{},
+			messages:   map[chatMessage]memoryMessage{},
+			overrides:  map[int64]map[string]string{},
+			weights:    map[int64]map[string]float64{},
+			limits:     map[int64]RateLimit{},
+			apiKeys:    map[string]models.APIKey{},
+
+			adjustments: map[int64][]models.Adjustment{},
+		},
+	}
+}
+
+// TopRating is a function which returns users rating for reactions
+// received in window
+func (m *Memory) TopRating(chatId int64, window Window) ([]models.User, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	categories := m.registry.Merge(m.overrides[chatId])
+	usermap := map[int64]models.User{}
+	resets := m.resets(chatId)
+
+	for key, createdAt := range m.reactions {
+		if key.ChatId != chatId ||
+			!window.contains(createdAt.Unix()) ||
+			!resets.reaction(key.UserId, createdAt) {
+			continue
+		}
+
+		tmp, exists := usermap[key.UserId]
+		if !exists {
+			tmp = models.User{UserId: key.UserId}
+		}
+
+		count(&tmp, categories[key.Reaction])
+
+		usermap[key.UserId] = tmp
+	}
+
+	for _, adjustment := range m.adjustments[chatId] {
+		if adjustment.Reset ||
+			!window.contains(adjustment.CreatedAt.Unix()) ||
+			!resets.adjustment(adjustment.UserId, adjustment.Id) {
+			continue
+		}
+
+		tmp, exists := usermap[adjustment.UserId]
+		if !exists {
+			tmp = models.User{UserId: adjustment.UserId}
+		}
+
+		adjust(&tmp, adjustment.Category, adjustment.Amount)
+
+		usermap[adjustment.UserId] = tmp
+	}
+
+	weights := mergeWeights(m.weights[chatId])
+	for userId, user := range usermap {
+		score(&user, weights)
+		usermap[userId] = user
+	}
+
+	return maps.Values(usermap), nil
+}
+
+// GetUserRating is a function which returns rating for specific user.
+func (m *Memory) GetUserRating(chatId, userId int64) (models.User, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	categories := m.registry.Merge(m.overrides[chatId])
+	user := models.User{UserId: userId}
+	resets := m.resets(chatId)
+
+	for key, createdAt := range m.reactions {
+		if key.ChatId != chatId ||
+			key.UserId != userId ||
+			!resets.reaction(userId, createdAt) {
+			continue
+		}
+
+		count(&user, categories[key.Reaction])
+	}
+
+	for _, adjustment := range m.adjustments[chatId] {
+		if adjustment.UserId != userId ||
+			adjustment.Reset ||
+			!resets.adjustment(userId, adjustment.Id) {
+			continue
+		}
+
+		adjust(&user, adjustment.Category, adjustment.Amount)
+	}
+
+	score(&user, mergeWeights(m.weights[chatId]))
+
+	return user, nil
+}
+
+// AddReaction is a function which adds reaction made at time to store
+func (m *Memory) AddReaction(chatId, fromUserId, userId, messageId int64, reaction string, at time.Time) error {
+	// No karma for you, buddy
+	if userId == fromUserId {
+		return nil
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	// Blacklist is checked at time reaction was made, so replayed
+	// reactions made before entry expired are skipped too
+	if entry, exists := m.blacklist[chatUser{chatId, userId}]; exists &&
+		active(entry, at) &&
+		entry.Mode != BlacklistGive {
+		// blacklist clause
+		return nil
+	}
+
+	if entry, exists := m.blacklist[chatUser{chatId, fromUserId}]; exists &&
+		active(entry, at) &&
+		entry.Mode != BlacklistReceive {
+		return nil
+	}
+
+	key := reactionKey{chatId, fromUserId, userId, messageId, reaction}
+	if _, exists := m.reactions[key]; exists {
+		return nil
+	}
+
+	policy, exists := m.limits[chatId]
+	if !exists {
+		policy = DefaultRateLimit
+	}
+
+	dropped, err := m.limiter.drop(chatId, fromUserId, userId, policy, at)
+	if err != nil {
+		return err
+	}
+
+	if dropped {
+		return nil
+	}
+
+	keep(m.batch, m.reactions, key)
+	m.reactions[key] = at
+
+	return nil
+}
+
+// RemoveReaction is a function which removes reaction from store
+func (m *Memory) RemoveReaction(chatId, fromUserId, messageId int64, reaction string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	for key := range m.reactions {
+		if key.ChatId == chatId &&
+			key.FromUserId == fromUserId &&
+			key.MessageId == messageId &&
+			key.Reaction == reaction {
+			keep(m.batch, m.reactions, key)
+			delete(m.reactions, key)
+		}
+	}
+
+	return nil
+}
+
+// GetReactions is a function which returns reactions set on messageId in chatId
+func (m *Memory) GetReactions(chatId, messageId int64) ([]models.Reaction, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var reactions []models.Reaction
+
+	for key := range m.reactions {
+		if key.ChatId != chatId || key.MessageId != messageId {
+			continue
+		}
+
+		reactions = append(reactions, models.Reaction{
+			UserId:   key.FromUserId,
+			Reaction: key.Reaction,
+		})
+	}
+
+	return reactions, nil
+}
+
+// AddBlacklist is a function which adds user into chatId blacklist,
+// expired entry of user is replaced
+func (m *Memory) AddBlacklist(chatId int64, entry models.BlacklistEntry) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	key := chatUser{chatId, entry.UserId}
+
+	if old, exists := m.blacklist[key]; exists && active(old, time.Now()) {
+		return ErrAlreadyBlacklisted
+	}
+
+	keep(m.batch, m.blacklist, key)
+	m.blacklist[key] = entry
+
+	return nil
+}
+
+// RemoveBlacklist is a function which removes user from chatId blacklist
+func (m *Memory) RemoveBlacklist(chatId, userId int64) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	key := chatUser{chatId, userId}
+
+	entry, exists := m.blacklist[key]
+	if !exists || !active(entry, time.Now()) {
+		return ErrNotInBlacklist
+	}
+
+	keep(m.batch, m.blacklist, key)
+	delete(m.blacklist, key)
+
+	return nil
+}
+
+// GetBlacklist is a function which returns active (not expired) chatId
+// blacklist entries
+func (m *Memory) GetBlacklist(chatId int64) ([]models.BlacklistEntry, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var entries []models.BlacklistEntry
+
+	now := time.Now()
+	for key, entry := range m.blacklist {
+		if key.ChatId == chatId && active(entry, now) {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+
+	return entries, nil
+}
+
+// AddModerator is a function which grants user bot moderation rights
+// in chatId
+func (m *Memory) AddModerator(chatId int64, moderator models.Moderator) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	key := chatUser{chatId, moderator.UserId}
+
+	if _, exists := m.moderators[key]; exists {
+		return ErrAlreadyModerator
+	}
+
+	keep(m.batch, m.moderators, key)
+	m.moderators[key] = moderator
+
+	return nil
+}
+
+// RemoveModerator is a function which revokes user bot moderation
+// rights in chatId
+func (m *Memory) RemoveModerator(chatId, userId int64) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	key := chatUser{chatId, userId}
+
+	if _, exists := m.moderators[key]; !exists {
+		return ErrNotModerator
+	}
+
+	keep(m.batch, m.moderators, key)
+	delete(m.moderators, key)
+
+	return nil
+}
+
+// GetModerators is a function which returns chatId bot moderators
+func (m *Memory) GetModerators(chatId int64) ([]models.Moderator, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var moderators []models.Moderator
+
+	for key, moderator := range m.moderators {
+		if key.ChatId == chatId {
+			moderators = append(moderators, moderator)
+		}
+	}
+
+	sort.Slice(moderators, func(i, j int) bool {
+		return moderators[i].CreatedAt.Before(moderators[j].CreatedAt)
+	})
+
+	return moderators, nil
+}
+
+// IsModerator is a function which reports whether userId is bot
+// moderator in chatId
+func (m *Memory) IsModerator(chatId, userId int64) (bool, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	_, exists := m.moderators[chatUser{chatId, userId}]
+
+	return exists, nil
+}
+
+// AddAdjustment is a function which records manual rating adjustment
+// (or reset) of user in chatId
+func (m *Memory) AddAdjustment(chatId int64, adjustment models.Adjustment) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.adjustmentId++
+	adjustment.Id = m.adjustmentId
+
+	m.adjustments[chatId] = append(m.adjustments[chatId], adjustment)
+
+	m.batch.record(func() {
+		m.adjustments[chatId] = slices.DeleteFunc(m.adjustments[chatId], func(added models.Adjustment) bool {
+			return added.Id == adjustment.Id
+		})
+	})
+
+	return nil
+}
+
+// GetAdjustments is a function which returns up to limit latest
+// adjustments of userId in chatId (of all users if userId is zero),
+// most recent first
+func (m *Memory) GetAdjustments(chatId, userId int64, limit int) ([]models.Adjustment, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var adjustments []models.Adjustment
+
+	all := m.adjustments[chatId]
+	for i := len(all) - 1; i >= 0 && len(adjustments) < limit; i-- {
+		if userId == 0 || all[i].UserId == userId {
+			adjustments = append(adjustments, all[i])
+		}
+	}
+
+	return adjustments, nil
+}
+
+// AddAudit is a function which appends privileged action entry into
+// audit log
+func (m *Memory) AddAudit(entry models.AuditEntry) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.auditId++
+	entry.Id = m.auditId
+
+	m.audit = append(m.audit, entry)
+
+	m.batch.record(func() {
+		m.audit = slices.DeleteFunc(m.audit, func(added models.AuditEntry) bool {
+			return added.Id == entry.Id
+		})
+	})
+
+	return nil
+}
+
+// GetAudit is a function which returns up to limit audit entries of
+// chatId (of all chats if chatId is zero) with id less than before (any
+// if before is zero), most recent first
+func (m *Memory) GetAudit(chatId, before int64, limit int) ([]models.AuditEntry, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var entries []models.AuditEntry
+
+	for i := len(m.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		entry := m.audit[i]
+
+		if (chatId == 0 || entry.ChatId == chatId) && (before == 0 || entry.Id < before) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// AddAPIKey is a function which stores webserver API key scoped to its
+// chats
+func (m *Memory) AddAPIKey(key models.APIKey) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if len(key.ChatIds) == 0 {
+		return ErrNoKeyChats
+	}
+
+	if _, exists := m.apiKeys[key.Id]; exists {
+		return ErrAPIKeyExists
+	}
+
+	chatIds := map[int64]bool{}
+	for _, chatId := range key.ChatIds {
+		chatIds[chatId] = true
+	}
+
+	key.ChatIds = maps.Keys(chatIds)
+	sort.Slice(key.ChatIds, func(i, j int) bool {
+		return key.ChatIds[i] < key.ChatIds[j]
+	})
+
+	keep(m.batch, m.apiKeys, key.Id)
+	m.apiKeys[key.Id] = key
+
+	return nil
+}
+
+// GetAPIKey is a function which returns API key by id. Returns
+// ErrUnknownAPIKey if there is no such key.
+func (m *Memory) GetAPIKey(id string) (models.APIKey, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	key, exists := m.apiKeys[id]
+	if !exists {
+		return models.APIKey{}, ErrUnknownAPIKey
+	}
+
+	return key, nil
+}
+
+// GetAPIKeys is a function which returns API keys allowed to post
+// reactions of chatId (all keys if chatId is zero)
+func (m *Memory) GetAPIKeys(chatId int64) ([]models.APIKey, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var keys []models.APIKey
+
+	for _, key := range m.apiKeys {
+		if chatId == 0 || slices.Contains(key.ChatIds, chatId) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+
+		return keys[i].Id < keys[j].Id
+	})
+
+	return keys, nil
+}
+
+// RemoveAPIKey is a function which revokes API key. Returns
+// ErrUnknownAPIKey if there is no such key.
+func (m *Memory) RemoveAPIKey(id string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if _, exists := m.apiKeys[id]; !exists {
+		return ErrUnknownAPIKey
+	}
+
+	keep(m.batch, m.apiKeys, id)
+	delete(m.apiKeys, id)
+
+	return nil
+}
+
+// resets is a function which returns latest rating resets of chatId users
+func (m *Memory) resets(chatId int64) resets {
+	resets := resets{}
+
+	for _, adjustment := range m.adjustments[chatId] {
+		if adjustment.Reset {
+			resets[adjustment.UserId] = reset{adjustment.Id, adjustment.CreatedAt}
+		}
+	}
+
+	return resets
+}
+
+// AddName is a function which records username and full name userId
+// was seen with in chatId at seen time
+func (m *Memory) AddName(chatId, userId int64, username, fullName string, seen time.Time) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	key := nameKey{chatId, userId, username, fullName}
+
+	keep(m.batch, m.names, key)
+
+	name, exists := m.names[key]
+	if !exists {
+		m.names[key] = models.Name{
+			UserId:    userId,
+			Username:  username,
+			FullName:  fullName,
+			FirstSeen: seen,
+			LastSeen:  seen,
+		}
+
+		return nil
+	}
+
+	if seen.Before(name.FirstSeen) {
+		name.FirstSeen = seen
+	}
+
+	if seen.After(name.LastSeen) {
+		name.LastSeen = seen
+	}
+
+	m.names[key] = name
+
+	return nil
+}
+
+// GetNames is a function which returns names userId was seen with in
+// chatId, most recent first
+func (m *Memory) GetNames(chatId, userId int64) ([]models.Name, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var names []models.Name
+
+	for key, name := range m.names {
+		if key.ChatId == chatId && key.UserId == userId {
+			names = append(names, name)
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return names[i].LastSeen.After(names[j].LastSeen)
+	})
+
+	return names, nil
+}
+
+// GetLatestNames is a function which returns most recent names of
+// userIds in chatId
+func (m *Memory) GetLatestNames(chatId int64, userIds []int64) (map[int64]models.Name, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	wanted := map[int64]bool{}
+	for _, userId := range userIds {
+		wanted[userId] = true
+	}
+
+	names := map[int64]models.Name{}
+
+	for key, name := range m.names {
+		if key.ChatId != chatId || !wanted[key.UserId] {
+			continue
+		}
+
+		if latest, exists := names[key.UserId]; !exists || name.LastSeen.After(latest.LastSeen) {
+			names[key.UserId] = name
+		}
+	}
+
+	return names, nil
+}
+
+// FindUser is a function which returns id of user last seen with
+// username in chatId. Returns ErrUnknownUser if there is no such user.
+func (m *Memory) FindUser(chatId int64, username string) (int64, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var (
+		found  bool
+		latest models.Name
+	)
+
+	for key, name := range m.names {
+		if key.ChatId != chatId || !strings.EqualFold(key.Username, username) {
+			continue
+		}
+
+		if !found || name.LastSeen.After(latest.LastSeen) {
+			found = true
+			latest = name
+		}
+	}
+
+	if !found {
+		return 0, ErrUnknownUser
+	}
+
+	return latest.UserId, nil
+}
+
+// AddMessage is a function which remembers message author seen at
+// time. Old authors are pruned outside of batches only, so batch has
+// nothing to put back.
+func (m *Memory) AddMessage(chatId, messageId, userId int64, at time.Time) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	key := chatMessage{chatId, messageId}
+
+	keep(m.batch, m.messages, key)
+	m.messages[key] = memoryMessage{userId: userId, seenAt: at}
+
+	m.added++
+	if m.added%messagePrune != 0 || m.batch != nil {
+		return nil
+	}
+
+	for key, message := range m.messages {
+		if message.seenAt.Before(at.Add(-messageRetention)) {
+			delete(m.messages, key)
+		}
+	}
+
+	return nil
+}
+
+// GetMessageAuthor is a function which returns author of messageId in chatId.
+// Returns ErrUnknownMessage if message was not seen before.
+func (m *Memory) GetMessageAuthor(chatId, messageId int64) (int64, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	message, exists := m.messages[chatMessage{chatId, messageId}]
+	if !exists {
+		return 0, ErrUnknownMessage
+	}
+
+	return message.userId, nil
+}
+
+// GetReactionMap is a function which returns reaction -> category map
+// used in chatId (registry defaults with chat overrides)
+func (m *Memory) GetReactionMap(chatId int64) (map[string]string, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return m.registry.Merge(m.overrides[chatId]), nil
+}
+
+// SetReactionCategory is a function which overrides reaction category
+// in chatId
+func (m *Memory) SetReactionCategory(chatId int64, reaction, category string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if _, exists := m.overrides[chatId]; !exists {
+		m.overrides[chatId] = map[string]string{}
+	}
+
+	keep(m.batch, m.overrides[chatId], reaction)
+	m.overrides[chatId][reaction] = category
+
+	return nil
+}
+
+// ResetReactionCategory is a function which drops chatId override of
+// reaction category
+func (m *Memory) ResetReactionCategory(chatId int64, reaction string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	keep(m.batch, m.overrides[chatId], reaction)
+	delete(m.overrides[chatId], reaction)
+
+	return nil
+}
+
+// GetWeights is a function which returns category -> score weight map
+// used in chatId (defaults with chat overrides)
+func (m *Memory) GetWeights(chatId int64) (map[string]float64, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return mergeWeights(m.weights[chatId]), nil
+}
+
+// SetWeight is a function which overrides category score weight in chatId
+func (m *Memory) SetWeight(chatId int64, category string, weight float64) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if _, exists := m.weights[chatId]; !exists {
+		m.weights[chatId] = map[string]float64{}
+	}
+
+	keep(m.batch, m.weights[chatId], category)
+	m.weights[chatId][category] = weight
+
+	return nil
+}
+
+// ResetWeight is a function which drops chatId override of category
+// score weight
+func (m *Memory) ResetWeight(chatId int64, category string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	keep(m.batch, m.weights[chatId], category)
+	delete(m.weights[chatId], category)
+
+	return nil
+}
+
+// GetRateLimit is a function which returns reactions rate limit policy
+// used in chatId, DefaultRateLimit unless chat overrides it
+func (m *Memory) GetRateLimit(chatId int64) (RateLimit, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	policy, exists := m.limits[chatId]
+	if !exists {
+		return DefaultRateLimit, nil
+	}
+
+	return policy, nil
+}
+
+// SetRateLimit is a function which overrides reactions rate limit
+// policy in chatId
+func (m *Memory) SetRateLimit(chatId int64, policy RateLimit) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	keep(m.batch, m.limits, chatId)
+	m.limits[chatId] = policy
+
+	return nil
+}
+
+// ResetRateLimit is a function which drops chatId override of
+// reactions rate limit policy
+func (m *Memory) ResetRateLimit(chatId int64) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	keep(m.batch, m.limits, chatId)
+	delete(m.limits, chatId)
+
+	return nil
+}
+
+// Close is a function which closes store, nothing to do here
+func (m *Memory) Close() error {
+	return nil
+}
+
+// Batch is a function which runs items one by one with store bound to
+// batch
+func (m *Memory) Batch(items []BatchItem, opts BatchOpts) ([]error, error) {
+	return batchItems(m, items, opts)
+}
+
+// BatchStream is a function which runs items next returns one by one
+// with store bound to batch. Memory has no transactions, so batch
+// changes are logged and failed item (or whole atomic or dry run batch)
+// is rolled back by undoing them; entries changed outside of batch
+// meanwhile are put back as well then. Batch reactions are counted by
+// store rate limiter right away, and their hits are undone with them.
+func (m *Memory) BatchStream(next func() BatchItem, report func(err error), opts BatchOpts) error {
+	batch := &memoryBatch{}
+
+	bound := *m
+	bound.batch = batch
+	bound.limiter = NewLimiter(&batchCooldowns{
+		store: m.cooldowns,
+		batch: batch,
+	})
+
+	switch {
+	case opts.NoCooldowns:
+		bound.limiter = nil
+	case opts.Cooldowns != nil:
+		bound.limiter = NewLimiter(opts.Cooldowns)
+	}
+
+	failed := false
+
+	for item := next(); item != nil; item = next() {
+		if failed && opts.Atomic {
+			report(ErrBatchAborted)
+			continue
+		}
+
+		mark := len(batch.undo)
+
+		err := item(&bound)
+		if err != nil {
+			failed = true
+			m.rollback(batch, mark)
+		}
+
+		report(err)
+	}
+
+	if failed && opts.Atomic {
+		m.rollback(batch, 0)
+		return ErrBatchAborted
+	}
+
+	if opts.DryRun {
+		m.rollback(batch, 0)
+	}
+
+	return nil
+}
+
+// rollback is a function which undoes batch changes made since mark
+// (number of changes batch had then), latest first
+func (m *Memory) rollback(batch *memoryBatch, mark int) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	for i := len(batch.undo) - 1; i >= mark; i-- {
+		batch.undo[i]()
+	}
+
+	batch.undo = batch.undo[:mark]
+}
+
+// memoryBatch is a change log of Memory batch
+type memoryBatch struct {
+	// undo are functions which undo batch changes, in order changes
+	// were made
+	undo []func()
+}
+
+// record is a function which logs undo of batch change, nothing is
+// logged outside of batch (nil batch)
+func (b *memoryBatch) record(undo func()) {
+	if b == nil {
+		return
+	}
+
+	b.undo = append(b.undo, undo)
+}
+
+// keep is a function which logs value of table key before batch changes
+// it, undo puts it back (or deletes key which was absent)
+func keep[K comparable, V any](batch *memoryBatch, table map[K]V, key K) {
+	value, exists := table[key]
+
+	batch.record(func() {
+		if exists {
+			table[key] = value
+		} else {
+			delete(table, key)
+		}
+	})
+}
+
+// batchCooldowns is a CooldownStore of Memory batch rate limiter, hits
+// are kept in store cooldowns right away and dropped if batch change
+// they are made with is undone
+type batchCooldowns struct {
+	store *MemoryCooldowns
+	batch *memoryBatch
+}
+
+// Hits is a function which returns number of not expired hits of key
+// made since from
+func (c *batchCooldowns) Hits(key string, from time.Time) (int, error) {
+	return c.store.Hits(key, from)
+}
+
+// Hit is a function which registers hit of key at time
+func (c *batchCooldowns) Hit(key string, at, expires time.Time) error {
+	err := c.store.Hit(key, at, expires)
+	if err != nil {
+		return err
+	}
+
+	c.batch.record(func() {
+		c.store.unhit(key, at)
+	})
+
+	return nil
+}
+
+// Close is a function which closes cooldowns, store ones are owned by
+// Memory
+func (c *batchCooldowns) Close() error {
+	return nil
+}
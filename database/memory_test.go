@@ -0,0 +1,136 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Memory batch changes and rate limiter are scoped to batch, store
+// changes made while it runs are kept
+func TestMemoryBatchScope(t *testing.T) {
+	like := ReactionKey("👍", "")
+	errFailed := errors.New("failed")
+
+	likes := func(t *testing.T, store Store) int {
+		t.Helper()
+
+		user, err := store.GetUserRating(-1, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return user.Reactions[CategoryLike]
+	}
+
+	t.Run("dry run keeps store changes", func(t *testing.T) {
+		store := NewMemory(DefaultRegistry())
+
+		_, err := store.Batch([]BatchItem{func(bound Store) error {
+			err := bound.SetWeight(-1, CategoryLike, 2)
+			if err != nil {
+				return err
+			}
+
+			return store.SetWeight(-1, CategoryDislike, -3)
+		}}, BatchOpts{DryRun: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		weights, err := store.GetWeights(-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if weights[CategoryLike] != 1 || weights[CategoryDislike] != -3 {
+			t.Errorf("weights = %v, want like 1 and dislike -3", weights)
+		}
+	})
+
+	t.Run("failed item is rolled back", func(t *testing.T) {
+		store := NewMemory(DefaultRegistry())
+
+		errs, err := store.Batch([]BatchItem{
+			func(bound Store) error {
+				return bound.AddReaction(-1, 1, 2, 1, like, time.Now())
+			},
+			func(bound Store) error {
+				err := bound.AddReaction(-1, 3, 2, 1, like, time.Now())
+				if err != nil {
+					return err
+				}
+
+				return errFailed
+			},
+		}, BatchOpts{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !errors.Is(errs[1], errFailed) {
+			t.Errorf("errs[1] = %v, want %v", errs[1], errFailed)
+		}
+
+		if n := likes(t, store); n != 1 {
+			t.Errorf("likes = %v, want 1", n)
+		}
+	})
+
+	t.Run("no cooldowns keeps store limiter", func(t *testing.T) {
+		store := NewMemory(DefaultRegistry())
+
+		err := store.SetRateLimit(-1, RateLimit{Window: time.Hour, Burst: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = store.Batch([]BatchItem{func(bound Store) error {
+			for messageId := int64(1); messageId <= 2; messageId++ {
+				err := store.AddReaction(-1, 1, 2, messageId, like, time.Now())
+				if err != nil {
+					return err
+				}
+
+				err = bound.AddReaction(-1, 1, 2, messageId+10, like, time.Now())
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}}, BatchOpts{NoCooldowns: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n := likes(t, store); n != 3 {
+			t.Errorf("likes = %v, want 3", n)
+		}
+	})
+
+	t.Run("dry run hits are dropped", func(t *testing.T) {
+		store := NewMemory(DefaultRegistry())
+
+		err := store.SetRateLimit(-1, RateLimit{Window: time.Hour, Burst: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = store.Batch([]BatchItem{func(bound Store) error {
+			return bound.AddReaction(-1, 1, 2, 1, like, time.Now())
+		}}, BatchOpts{DryRun: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.AddReaction(-1, 1, 2, 2, like, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n := likes(t, store); n != 1 {
+			t.Errorf("likes = %v, want 1", n)
+		}
+	})
+}
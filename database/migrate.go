@@ -0,0 +1,258 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationsFS is a directory with SQL migrations, one subdirectory per
+// dialect, files are named as <version>_<name>.<up|down>.sql
+//
+//go:embed migrations
+var migrationsFS embed.FS
+
+// ErrUnknownVersion is returned when migration target is out of range
+var ErrUnknownVersion = errors.New("unknown schema version")
+
+// ErrNewerSchema is returned when database schema is newer than
+// migrations known to binary, so they can't be reverted
+var ErrNewerSchema = errors.New("database schema is newer than binary")
+
+// migration is a single schema change step
+type migration struct {
+	// Version is a schema version after applying step
+	Version int
+
+	// Name is a human-readable step name
+	Name string
+
+	// Up is a SQL which applies step
+	Up string
+
+	// Down is a SQL which reverts step
+	Down string
+}
+
+// Migrator is a type which applies embedded schema migrations to database
+type Migrator struct {
+	db         *sql.DB
+	migrations []migration
+}
+
+// NewMigrator is a function which creates Migrator for db with
+// migrations of dialect ("sqlite" or "postgres")
+func NewMigrator(db *sql.DB, dialect string) (*Migrator, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// loadMigrations is a function which reads migrations of dialect
+// sorted by version
+func loadMigrations(dialect string) ([]migration, error) {
+	dir := path.Join("migrations", dialect)
+
+	files, err := fs.ReadDir(migrationsFS, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+
+	for _, file := range files {
+		name, direction, found := strings.Cut(
+			strings.TrimSuffix(file.Name(), ".sql"),
+			".",
+		)
+		if !found {
+			return nil, fmt.Errorf("bad migration file name: %v", file.Name())
+		}
+
+		versionStr, title, _ := strings.Cut(name, "_")
+
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("bad migration file name: %v", file.Name())
+		}
+
+		content, err := migrationsFS.ReadFile(path.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if _, exists := byVersion[version]; !exists {
+			byVersion[version] = &migration{Version: version, Name: title}
+		}
+
+		switch direction {
+		case "up":
+			byVersion[version].Up = string(content)
+		case "down":
+			byVersion[version].Down = string(content)
+		default:
+			return nil, fmt.Errorf("bad migration file name: %v", file.Name())
+		}
+	}
+
+	var migrations []migration
+	for _, x := range byVersion {
+		migrations = append(migrations, *x)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, x := range migrations {
+		if x.Version != i+1 {
+			return nil, fmt.Errorf("migration %v is missing", i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Latest is a function which returns newest known schema version
+func (m *Migrator) Latest() int {
+	return len(m.migrations)
+}
+
+// Version is a function which returns current database schema version.
+// Databases created before migrations were introduced have version 0.
+func (m *Migrator) Version() (int, error) {
+	_, err := m.db.Exec(
+		`CREATE TABLE IF NOT EXISTS schema_version(version INTEGER NOT NULL)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+
+	err = m.db.QueryRow(`SELECT version FROM schema_version`).Scan(&version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Up is a function which applies all pending migrations
+func (m *Migrator) Up() error {
+	return m.Migrate(m.Latest())
+}
+
+// Migrate is a function which applies (or reverts) migrations
+// until schema has target version
+func (m *Migrator) Migrate(target int) error {
+	if target < 0 || target > m.Latest() {
+		return ErrUnknownVersion
+	}
+
+	version, err := m.Version()
+	if err != nil {
+		return err
+	}
+
+	if version > m.Latest() {
+		return ErrNewerSchema
+	}
+
+	for version < target {
+		step := m.migrations[version]
+
+		err := m.apply(step.Up, step.Version)
+		if err != nil {
+			return fmt.Errorf("migration %v up: %w", step.Version, err)
+		}
+
+		version = step.Version
+	}
+
+	for version > target {
+		step := m.migrations[version-1]
+
+		err := m.apply(step.Down, step.Version-1)
+		if err != nil {
+			return fmt.Errorf("migration %v down: %w", step.Version, err)
+		}
+
+		version = step.Version - 1
+	}
+
+	return nil
+}
+
+// apply is a function which runs migration SQL and stores new version
+// in single transaction
+func (m *Migrator) apply(query string, version int) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(query)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM schema_version`)
+	if err != nil {
+		return err
+	}
+
+	// version is an integer, safe to inline and avoids placeholder dialects
+	_, err = tx.Exec(fmt.Sprintf(`INSERT INTO schema_version VALUES(%d)`, version))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// OpenMigrator is a function which opens database selected by dsn
+// (same as Open) without touching its schema. Migrator must be closed
+// after use.
+func OpenMigrator(dsn string) (*Migrator, error) {
+	driver, dialect, source := "sqlite3", "sqlite", sqliteSource(dsn)
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		driver, dialect, source = "postgres", "postgres", dsn
+	}
+
+	if dsn == "memory" {
+		return nil, errors.New("in-memory store has no schema")
+	}
+
+	db, err := sql.Open(driver, source)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := NewMigrator(db, dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return migrator, nil
+}
+
+// Close is a function which closes migrator database
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
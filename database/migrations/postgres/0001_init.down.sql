@@ -0,0 +1,4 @@
+DROP TABLE messages;
+DROP TABLE username;
+DROP TABLE blacklist;
+DROP TABLE reactions;
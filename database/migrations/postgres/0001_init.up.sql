@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS reactions(
+    chat_id BIGINT NOT NULL,
+    from_user_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    message_id BIGINT NOT NULL,
+    reaction TEXT NOT NULL,
+
+    PRIMARY KEY ( chat_id, from_user_id, user_id, message_id, reaction )
+);
+
+CREATE TABLE IF NOT EXISTS blacklist(
+    chat_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS username(
+    user_id BIGINT NOT NULL,
+    username TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS messages(
+    chat_id BIGINT NOT NULL,
+    message_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+
+    PRIMARY KEY ( chat_id, message_id )
+);
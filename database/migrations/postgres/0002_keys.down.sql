@@ -0,0 +1,5 @@
+DROP INDEX reactions_user;
+DROP INDEX reactions_message;
+
+ALTER TABLE username DROP CONSTRAINT username_pkey;
+ALTER TABLE blacklist DROP CONSTRAINT blacklist_pkey;
@@ -0,0 +1,13 @@
+DELETE FROM blacklist a USING blacklist b
+WHERE a.ctid < b.ctid AND a.chat_id = b.chat_id AND a.user_id = b.user_id;
+
+ALTER TABLE blacklist ADD PRIMARY KEY ( chat_id, user_id );
+
+-- Latest username wins
+DELETE FROM username a USING username b
+WHERE a.ctid < b.ctid AND a.user_id = b.user_id;
+
+ALTER TABLE username ADD PRIMARY KEY ( user_id );
+
+CREATE INDEX reactions_message ON reactions ( chat_id, message_id );
+CREATE INDEX reactions_user ON reactions ( chat_id, user_id );
@@ -0,0 +1,7 @@
+CREATE TABLE reaction_map(
+    chat_id BIGINT NOT NULL,
+    reaction TEXT NOT NULL,
+    category TEXT NOT NULL,
+
+    PRIMARY KEY ( chat_id, reaction )
+);
@@ -0,0 +1,7 @@
+CREATE TABLE weights(
+    chat_id BIGINT NOT NULL,
+    category TEXT NOT NULL,
+    weight DOUBLE PRECISION NOT NULL,
+
+    PRIMARY KEY ( chat_id, category )
+);
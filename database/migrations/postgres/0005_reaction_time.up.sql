@@ -0,0 +1,4 @@
+-- Reactions received before this migration have unknown time (0)
+ALTER TABLE reactions ADD COLUMN created_at BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX reactions_time ON reactions ( chat_id, created_at );
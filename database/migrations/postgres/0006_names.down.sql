@@ -0,0 +1,12 @@
+CREATE TABLE username(
+    user_id BIGINT NOT NULL PRIMARY KEY,
+    username TEXT NOT NULL
+);
+
+-- Latest name wins
+INSERT INTO username
+SELECT DISTINCT ON ( user_id )
+    user_id, CASE WHEN username != '' THEN username ELSE full_name END
+FROM names ORDER BY user_id, last_seen DESC;
+
+DROP TABLE names;
@@ -0,0 +1,7 @@
+CREATE TABLE rate_limits(
+    chat_id BIGINT NOT NULL PRIMARY KEY,
+    window_seconds BIGINT NOT NULL,
+    burst INTEGER NOT NULL,
+    daily INTEGER NOT NULL,
+    per_receiver BOOLEAN NOT NULL
+);
@@ -0,0 +1,9 @@
+-- Rate limiter hits, times are unix nanoseconds
+CREATE TABLE cooldowns(
+    key TEXT NOT NULL,
+    at BIGINT NOT NULL,
+    expires BIGINT NOT NULL
+);
+
+CREATE INDEX cooldowns_key ON cooldowns ( key, at );
+CREATE INDEX cooldowns_expires ON cooldowns ( expires );
@@ -0,0 +1,7 @@
+-- Expired entries would become permanent
+DELETE FROM blacklist WHERE expires_at != 0 AND expires_at <= EXTRACT(EPOCH FROM now());
+
+ALTER TABLE blacklist DROP COLUMN expires_at;
+ALTER TABLE blacklist DROP COLUMN created_at;
+ALTER TABLE blacklist DROP COLUMN reason;
+ALTER TABLE blacklist DROP COLUMN actor_id;
@@ -0,0 +1,6 @@
+-- Entries made before this migration have unknown actor and time,
+-- and never expire (0)
+ALTER TABLE blacklist ADD COLUMN actor_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE blacklist ADD COLUMN reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE blacklist ADD COLUMN created_at BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE blacklist ADD COLUMN expires_at BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- Entries which didn't stop user from receiving rating can't be kept
+DELETE FROM blacklist WHERE mode = 'give';
+
+ALTER TABLE blacklist DROP COLUMN mode;
@@ -0,0 +1,2 @@
+-- Entries made before this migration only stop user from receiving rating
+ALTER TABLE blacklist ADD COLUMN mode TEXT NOT NULL DEFAULT 'receive';
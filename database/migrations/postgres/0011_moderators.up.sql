@@ -0,0 +1,8 @@
+CREATE TABLE moderators(
+    chat_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    actor_id BIGINT NOT NULL,
+    created_at BIGINT NOT NULL,
+
+    PRIMARY KEY ( chat_id, user_id )
+);
@@ -0,0 +1,14 @@
+-- Manual rating corrections, resets hide everything user got before them
+CREATE TABLE adjustments(
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    actor_id BIGINT NOT NULL,
+    category TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    is_reset BOOLEAN NOT NULL,
+    reason TEXT NOT NULL,
+    created_at BIGINT NOT NULL
+);
+
+CREATE INDEX adjustments_user ON adjustments ( chat_id, user_id );
@@ -0,0 +1,21 @@
+-- Privileged actions log, rows can't be changed or deleted
+CREATE TABLE audit(
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    actor_id BIGINT NOT NULL,
+    target_id BIGINT NOT NULL,
+    action TEXT NOT NULL,
+    params TEXT NOT NULL,
+    created_at BIGINT NOT NULL
+);
+
+CREATE INDEX audit_chat ON audit ( chat_id, id );
+
+CREATE FUNCTION audit_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_append_only BEFORE UPDATE OR DELETE ON audit
+FOR EACH ROW EXECUTE FUNCTION audit_append_only();
@@ -0,0 +1,16 @@
+-- Webserver API keys, every key posts reactions of its chats only
+CREATE TABLE api_keys(
+    id TEXT NOT NULL PRIMARY KEY,
+    secret TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    expires_at BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE api_key_chats(
+    key_id TEXT NOT NULL,
+    chat_id BIGINT NOT NULL,
+
+    PRIMARY KEY ( key_id, chat_id )
+);
+
+CREATE INDEX api_key_chats_chat ON api_key_chats ( chat_id );
@@ -0,0 +1,7 @@
+-- Message authors are kept for retention period since message was seen,
+-- existing ones are counted from migration
+ALTER TABLE messages ADD COLUMN seen_at BIGINT NOT NULL DEFAULT 0;
+
+UPDATE messages SET seen_at = EXTRACT(EPOCH FROM now())::BIGINT;
+
+CREATE INDEX messages_seen_at ON messages ( seen_at );
@@ -0,0 +1,20 @@
+DROP INDEX reactions_user;
+DROP INDEX reactions_message;
+
+CREATE TABLE username_old(
+    user_id INTEGER NOT NULL,
+    username TEXT NOT NULL
+);
+
+INSERT INTO username_old SELECT user_id, username FROM username;
+DROP TABLE username;
+ALTER TABLE username_old RENAME TO username;
+
+CREATE TABLE blacklist_old(
+    chat_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL
+);
+
+INSERT INTO blacklist_old SELECT chat_id, user_id FROM blacklist;
+DROP TABLE blacklist;
+ALTER TABLE blacklist_old RENAME TO blacklist;
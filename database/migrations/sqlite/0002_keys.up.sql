@@ -0,0 +1,24 @@
+-- SQLite can't add primary key to existing table, so tables are rebuilt
+-- with duplicates dropped (latest username wins)
+CREATE TABLE blacklist_new(
+    chat_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+
+    PRIMARY KEY ( chat_id, user_id )
+);
+
+INSERT OR IGNORE INTO blacklist_new SELECT chat_id, user_id FROM blacklist;
+DROP TABLE blacklist;
+ALTER TABLE blacklist_new RENAME TO blacklist;
+
+CREATE TABLE username_new(
+    user_id INTEGER NOT NULL PRIMARY KEY,
+    username TEXT NOT NULL
+);
+
+INSERT OR REPLACE INTO username_new SELECT user_id, username FROM username ORDER BY rowid;
+DROP TABLE username;
+ALTER TABLE username_new RENAME TO username;
+
+CREATE INDEX reactions_message ON reactions ( chat_id, message_id );
+CREATE INDEX reactions_user ON reactions ( chat_id, user_id );
@@ -0,0 +1 @@
+DROP TABLE reaction_map;
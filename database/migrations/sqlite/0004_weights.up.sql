@@ -0,0 +1,7 @@
+CREATE TABLE weights(
+    chat_id INTEGER NOT NULL,
+    category TEXT NOT NULL,
+    weight REAL NOT NULL,
+
+    PRIMARY KEY ( chat_id, category )
+);
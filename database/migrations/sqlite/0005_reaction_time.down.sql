@@ -0,0 +1,3 @@
+DROP INDEX reactions_time;
+
+ALTER TABLE reactions DROP COLUMN created_at;
@@ -0,0 +1,11 @@
+CREATE TABLE username(
+    user_id INTEGER NOT NULL PRIMARY KEY,
+    username TEXT NOT NULL
+);
+
+-- Latest name wins
+INSERT OR REPLACE INTO username
+SELECT user_id, CASE WHEN username != '' THEN username ELSE full_name END
+FROM names ORDER BY last_seen;
+
+DROP TABLE names;
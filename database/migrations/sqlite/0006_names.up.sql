@@ -0,0 +1,25 @@
+-- Names history: every username and full name user was seen with in chat
+CREATE TABLE names(
+    chat_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    username TEXT NOT NULL,
+    full_name TEXT NOT NULL,
+    first_seen INTEGER NOT NULL,
+    last_seen INTEGER NOT NULL,
+
+    PRIMARY KEY ( chat_id, user_id, username, full_name )
+);
+
+CREATE INDEX names_latest ON names ( chat_id, user_id, last_seen );
+
+-- Global names are copied into chats user got reactions or wrote in,
+-- it's unknown if they were usernames and when they were seen
+INSERT OR IGNORE INTO names
+SELECT chats.chat_id, username.user_id, '', username.username, 0, 0
+FROM username JOIN (
+    SELECT chat_id, user_id FROM reactions
+    UNION
+    SELECT chat_id, user_id FROM messages
+) chats ON chats.user_id = username.user_id;
+
+DROP TABLE username;
@@ -0,0 +1,7 @@
+CREATE TABLE rate_limits(
+    chat_id INTEGER NOT NULL PRIMARY KEY,
+    window_seconds INTEGER NOT NULL,
+    burst INTEGER NOT NULL,
+    daily INTEGER NOT NULL,
+    per_receiver INTEGER NOT NULL
+);
@@ -0,0 +1,8 @@
+CREATE TABLE moderators(
+    chat_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    actor_id INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+
+    PRIMARY KEY ( chat_id, user_id )
+);
@@ -0,0 +1,14 @@
+-- Manual rating corrections, resets hide everything user got before them
+CREATE TABLE adjustments(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    actor_id INTEGER NOT NULL,
+    category TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    is_reset INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX adjustments_user ON adjustments ( chat_id, user_id );
@@ -0,0 +1,3 @@
+ALTER TABLE adjustments DROP COLUMN created_at_ns;
+
+ALTER TABLE reactions DROP COLUMN created_at_ns;
@@ -0,0 +1,10 @@
+-- Reactions are ordered with rating resets by nanoseconds, so reactions
+-- made in the same second as reset are not lost
+ALTER TABLE reactions ADD COLUMN created_at_ns INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE adjustments ADD COLUMN created_at_ns INTEGER NOT NULL DEFAULT 0;
+
+UPDATE reactions SET created_at_ns = created_at * 1000000000;
+
+-- Existing resets keep hiding the whole second they were made in
+UPDATE adjustments SET created_at_ns = created_at * 1000000000
+    + CASE WHEN is_reset THEN 999999999 ELSE 0 END;
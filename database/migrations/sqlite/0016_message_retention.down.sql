@@ -0,0 +1,3 @@
+DROP INDEX messages_seen_at;
+
+ALTER TABLE messages DROP COLUMN seen_at;
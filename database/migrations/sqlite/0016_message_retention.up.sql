@@ -0,0 +1,7 @@
+-- Message authors are kept for retention period since message was seen,
+-- existing ones are counted from migration
+ALTER TABLE messages ADD COLUMN seen_at INTEGER NOT NULL DEFAULT 0;
+
+UPDATE messages SET seen_at = CAST(strftime('%s', 'now') AS INTEGER);
+
+CREATE INDEX messages_seen_at ON messages ( seen_at );
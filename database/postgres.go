@@ -0,0 +1,1215 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/xbt573/flood-social-rep/models"
+	"golang.org/x/exp/maps"
+	"sync/atomic"
+	"time"
+)
+
+// Postgres is a Store which keeps everything in PostgreSQL database
+type Postgres struct {
+	// pool is a long-lived connection pool, db is a pool or batch
+	// transaction queries are run in
+	pool *sql.DB
+	db   queryer
+
+	// registry is a default reaction mapping
+	registry *Registry
+
+	// limiter is a reactions rate limiter, it keeps hits in cooldowns
+	limiter   *Limiter
+	cooldowns *SQLCooldowns
+
+	// messages is a number of remembered messages, old ones are pruned
+	// every messagePrune of them
+	messages *atomic.Int64
+}
+
+// NewPostgres is a function which connects to PostgreSQL by dsn and
+// initializes it for first time use (if was not initialized before).
+// Returns non-nil error if something goes wrong!
+func NewPostgres(dsn string, registry *Registry) (*Postgres, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Postgres{pool: db, db: db, registry: registry, messages: &atomic.Int64{}}
+
+	err = p.init()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	p.cooldowns, err = NewSQLCooldowns(db, "postgres", time.Now)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	p.limiter = NewLimiter(p.cooldowns)
+
+	return p, nil
+}
+
+// init is a function which applies pending schema migrations
+func (p *Postgres) init() error {
+	migrator, err := NewMigrator(p.pool, "postgres")
+	if err != nil {
+		return err
+	}
+
+	return migrator.Up()
+}
+
+// TopRating is a function which returns users rating for reactions
+// received in window
+func (p *Postgres) TopRating(chatId int64, window Window) ([]models.User, error) {
+	categories, err := p.GetReactionMap(chatId)
+	if err != nil {
+		return []models.User{}, err
+	}
+
+	weights, err := p.GetWeights(chatId)
+	if err != nil {
+		return []models.User{}, err
+	}
+
+	from, to := window.bounds()
+
+	// reactions user got before rating reset are not counted
+	rows, err := p.db.Query(
+		`SELECT user_id, reaction FROM reactions r
+		WHERE chat_id=$1 AND created_at >= $2 AND created_at < $3
+		AND created_at_ns > COALESCE((SELECT MAX(created_at_ns) FROM adjustments
+			WHERE chat_id=$1 AND user_id=r.user_id AND is_reset), -1)`,
+		chatId,
+		from,
+		to,
+	)
+	if err != nil {
+		return []models.User{}, err
+	}
+	defer rows.Close()
+
+	usermap := map[int64]models.User{}
+
+	for rows.Next() {
+		var userId int64
+		var reaction string
+
+		err := rows.Scan(&userId, &reaction)
+		if err != nil {
+			return []models.User{}, err
+		}
+
+		tmp, exists := usermap[userId]
+		if !exists {
+			tmp = models.User{UserId: userId}
+		}
+
+		count(&tmp, categories[reaction])
+
+		usermap[userId] = tmp
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []models.User{}, err
+	}
+
+	adjustments, err := p.db.Query(
+		`SELECT user_id, category, amount FROM adjustments a
+		WHERE chat_id=$1 AND NOT is_reset AND created_at >= $2 AND created_at < $3
+		AND id > COALESCE((SELECT MAX(id) FROM adjustments
+			WHERE chat_id=$1 AND user_id=a.user_id AND is_reset), 0)`,
+		chatId,
+		from,
+		to,
+	)
+	if err != nil {
+		return []models.User{}, err
+	}
+	defer adjustments.Close()
+
+	for adjustments.Next() {
+		var (
+			userId   int64
+			category string
+			amount   int
+		)
+
+		err := adjustments.Scan(&userId, &category, &amount)
+		if err != nil {
+			return []models.User{}, err
+		}
+
+		tmp, exists := usermap[userId]
+		if !exists {
+			tmp = models.User{UserId: userId}
+		}
+
+		adjust(&tmp, category, amount)
+
+		usermap[userId] = tmp
+	}
+
+	err = adjustments.Err()
+	if err != nil {
+		return []models.User{}, err
+	}
+
+	for userId, user := range usermap {
+		score(&user, weights)
+		usermap[userId] = user
+	}
+
+	return maps.Values(usermap), nil
+}
+
+// GetUserRating is a function which returns rating for specific user.
+func (p *Postgres) GetUserRating(chatId, userId int64) (models.User, error) {
+	categories, err := p.GetReactionMap(chatId)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	weights, err := p.GetWeights(chatId)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	rows, err := p.db.Query(
+		`SELECT reaction FROM reactions WHERE chat_id=$1 AND user_id=$2
+		AND created_at_ns > COALESCE((SELECT MAX(created_at_ns) FROM adjustments
+			WHERE chat_id=$1 AND user_id=$2 AND is_reset), -1)`,
+		chatId,
+		userId,
+	)
+	if err != nil {
+		return models.User{}, err
+	}
+	defer rows.Close()
+
+	user := models.User{UserId: userId}
+
+	for rows.Next() {
+		var reaction string
+
+		err := rows.Scan(&reaction)
+		if err != nil {
+			return models.User{}, err
+		}
+
+		count(&user, categories[reaction])
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	adjustments, err := p.db.Query(
+		`SELECT category, amount FROM adjustments
+		WHERE chat_id=$1 AND user_id=$2 AND NOT is_reset
+		AND id > COALESCE((SELECT MAX(id) FROM adjustments
+			WHERE chat_id=$1 AND user_id=$2 AND is_reset), 0)`,
+		chatId,
+		userId,
+	)
+	if err != nil {
+		return models.User{}, err
+	}
+	defer adjustments.Close()
+
+	for adjustments.Next() {
+		var (
+			category string
+			amount   int
+		)
+
+		err := adjustments.Scan(&category, &amount)
+		if err != nil {
+			return models.User{}, err
+		}
+
+		adjust(&user, category, amount)
+	}
+
+	err = adjustments.Err()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	score(&user, weights)
+
+	return user, nil
+}
+
+// AddReaction is a function which adds reaction made at time to database
+func (p *Postgres) AddReaction(chatId, fromUserId, userId, messageId int64, reaction string, at time.Time) error {
+	// No karma for you, buddy
+	if userId == fromUserId {
+		return nil
+	}
+
+	var blacklisted bool
+
+	err := p.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM blacklist WHERE chat_id=$1
+		AND (
+			(user_id=$2 AND mode IN ('receive', 'both')) OR
+			(user_id=$3 AND mode IN ('give', 'both'))
+		)
+		AND (expires_at=0 OR expires_at>$4))`,
+		chatId,
+		userId,
+		fromUserId,
+		at.Unix(),
+	).Scan(&blacklisted)
+	if err != nil {
+		return err
+	}
+
+	if blacklisted {
+		// blacklist clause
+		return nil
+	}
+
+	// Reactions already stored are not counted by rate limiter again
+	var exists bool
+
+	err = p.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM reactions WHERE chat_id=$1 AND from_user_id=$2
+		AND user_id=$3 AND message_id=$4 AND reaction=$5)`,
+		chatId,
+		fromUserId,
+		userId,
+		messageId,
+		reaction,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	policy, err := p.GetRateLimit(chatId)
+	if err != nil {
+		return err
+	}
+
+	dropped, err := p.limiter.drop(chatId, fromUserId, userId, policy, at)
+	if err != nil {
+		return err
+	}
+
+	if dropped {
+		return nil
+	}
+
+	// ignore constraint error 🐳
+	_, err = p.db.Exec(
+		`INSERT INTO reactions
+		(chat_id, from_user_id, user_id, message_id, reaction, created_at, created_at_ns)
+		VALUES($1, $2, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING`,
+		chatId,
+		fromUserId,
+		userId,
+		messageId,
+		reaction,
+		at.Unix(),
+		at.UnixNano(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RemoveReaction is a function which removes reaction from database
+func (p *Postgres) RemoveReaction(chatId, fromUserId, messageId int64, reaction string) error {
+	_, err := p.db.Exec(
+		`DELETE FROM reactions
+		WHERE chat_id=$1 AND from_user_id=$2 AND message_id=$3 AND reaction=$4`,
+		chatId,
+		fromUserId,
+		messageId,
+		reaction,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetReactions is a function which returns reactions set on messageId in chatId
+func (p *Postgres) GetReactions(chatId, messageId int64) ([]models.Reaction, error) {
+	rows, err := p.db.Query(
+		"SELECT from_user_id, reaction FROM reactions WHERE chat_id=$1 AND message_id=$2",
+		chatId,
+		messageId,
+	)
+	if err != nil {
+		return []models.Reaction{}, err
+	}
+	defer rows.Close()
+
+	var reactions []models.Reaction
+
+	for rows.Next() {
+		var fromUserId int64
+		var reaction string
+
+		err := rows.Scan(&fromUserId, &reaction)
+		if err != nil {
+			return []models.Reaction{}, err
+		}
+
+		reactions = append(reactions, models.Reaction{
+			UserId:   fromUserId,
+			Reaction: reaction,
+		})
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []models.Reaction{}, err
+	}
+
+	return reactions, nil
+}
+
+// AddBlacklist is a function which adds user into chatId blacklist,
+// expired entry of user is replaced
+func (p *Postgres) AddBlacklist(chatId int64, entry models.BlacklistEntry) error {
+	// expired entry is replaced, active one is kept
+	res, err := p.db.Exec(
+		`INSERT INTO blacklist
+		(chat_id, user_id, actor_id, reason, created_at, expires_at, mode)
+		VALUES($1, $2, $3, $4, $5, $6, $8)
+		ON CONFLICT (chat_id, user_id) DO UPDATE SET
+			mode=excluded.mode,
+			actor_id=excluded.actor_id,
+			reason=excluded.reason,
+			created_at=excluded.created_at,
+			expires_at=excluded.expires_at
+		WHERE blacklist.expires_at!=0 AND blacklist.expires_at<=$7`,
+		chatId,
+		entry.UserId,
+		entry.ActorId,
+		entry.Reason,
+		unixTime(entry.CreatedAt),
+		unixTime(entry.ExpiresAt),
+		time.Now().Unix(),
+		entry.Mode,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrAlreadyBlacklisted
+	}
+
+	return nil
+}
+
+// RemoveBlacklist is a function which removes user from chatId blacklist
+func (p *Postgres) RemoveBlacklist(chatId, userId int64) error {
+	res, err := p.db.Exec(
+		`DELETE FROM blacklist WHERE chat_id=$1 AND user_id=$2
+		AND (expires_at=0 OR expires_at>$3)`,
+		chatId,
+		userId,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotInBlacklist
+	}
+
+	return nil
+}
+
+// GetBlacklist is a function which returns active (not expired) chatId
+// blacklist entries
+func (p *Postgres) GetBlacklist(chatId int64) ([]models.BlacklistEntry, error) {
+	rows, err := p.db.Query(
+		`SELECT user_id, mode, actor_id, reason, created_at, expires_at FROM blacklist
+		WHERE chat_id=$1 AND (expires_at=0 OR expires_at>$2) ORDER BY created_at`,
+		chatId,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return []models.BlacklistEntry{}, err
+	}
+	defer rows.Close()
+
+	var entries []models.BlacklistEntry
+
+	for rows.Next() {
+		var (
+			entry                models.BlacklistEntry
+			createdAt, expiresAt int64
+		)
+
+		err := rows.Scan(
+			&entry.UserId,
+			&entry.Mode,
+			&entry.ActorId,
+			&entry.Reason,
+			&createdAt,
+			&expiresAt,
+		)
+		if err != nil {
+			return []models.BlacklistEntry{}, err
+		}
+
+		entry.CreatedAt = seenTime(createdAt)
+		entry.ExpiresAt = seenTime(expiresAt)
+
+		entries = append(entries, entry)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []models.BlacklistEntry{}, err
+	}
+
+	return entries, nil
+}
+
+// AddModerator is a function which grants user bot moderation rights
+// in chatId
+func (p *Postgres) AddModerator(chatId int64, moderator models.Moderator) error {
+	res, err := p.db.Exec(
+		`INSERT INTO moderators VALUES($1, $2, $3, $4)
+		ON CONFLICT (chat_id, user_id) DO NOTHING`,
+		chatId,
+		moderator.UserId,
+		moderator.ActorId,
+		unixTime(moderator.CreatedAt),
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrAlreadyModerator
+	}
+
+	return nil
+}
+
+// RemoveModerator is a function which revokes user bot moderation
+// rights in chatId
+func (p *Postgres) RemoveModerator(chatId, userId int64) error {
+	res, err := p.db.Exec(
+		`DELETE FROM moderators WHERE chat_id=$1 AND user_id=$2`,
+		chatId,
+		userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotModerator
+	}
+
+	return nil
+}
+
+// GetModerators is a function which returns chatId bot moderators
+func (p *Postgres) GetModerators(chatId int64) ([]models.Moderator, error) {
+	rows, err := p.db.Query(
+		`SELECT user_id, actor_id, created_at FROM moderators
+		WHERE chat_id=$1 ORDER BY created_at`,
+		chatId,
+	)
+	if err != nil {
+		return []models.Moderator{}, err
+	}
+	defer rows.Close()
+
+	var moderators []models.Moderator
+
+	for rows.Next() {
+		var (
+			moderator models.Moderator
+			createdAt int64
+		)
+
+		err := rows.Scan(&moderator.UserId, &moderator.ActorId, &createdAt)
+		if err != nil {
+			return []models.Moderator{}, err
+		}
+
+		moderator.CreatedAt = seenTime(createdAt)
+
+		moderators = append(moderators, moderator)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []models.Moderator{}, err
+	}
+
+	return moderators, nil
+}
+
+// IsModerator is a function which reports whether userId is bot
+// moderator in chatId
+func (p *Postgres) IsModerator(chatId, userId int64) (bool, error) {
+	var exists bool
+
+	err := p.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM moderators WHERE chat_id=$1 AND user_id=$2)`,
+		chatId,
+		userId,
+	).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// AddAdjustment is a function which records manual rating adjustment
+// (or reset) of user in chatId
+func (p *Postgres) AddAdjustment(chatId int64, adjustment models.Adjustment) error {
+	_, err := p.db.Exec(
+		`INSERT INTO adjustments
+		(chat_id, user_id, actor_id, category, amount, is_reset, reason, created_at, created_at_ns)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		chatId,
+		adjustment.UserId,
+		adjustment.ActorId,
+		adjustment.Category,
+		adjustment.Amount,
+		adjustment.Reset,
+		adjustment.Reason,
+		unixTime(adjustment.CreatedAt),
+		unixNano(adjustment.CreatedAt),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetAdjustments is a function which returns up to limit latest
+// adjustments of userId in chatId (of all users if userId is zero),
+// most recent first
+func (p *Postgres) GetAdjustments(chatId, userId int64, limit int) ([]models.Adjustment, error) {
+	rows, err := p.db.Query(
+		`SELECT id, user_id, actor_id, category, amount, is_reset, reason, created_at
+		FROM adjustments WHERE chat_id=$1 AND ($2::BIGINT=0 OR user_id=$2)
+		ORDER BY id DESC LIMIT $3`,
+		chatId,
+		userId,
+		limit,
+	)
+	if err != nil {
+		return []models.Adjustment{}, err
+	}
+	defer rows.Close()
+
+	return scanAdjustments(rows)
+}
+
+// AddAudit is a function which appends privileged action entry into
+// audit log
+func (p *Postgres) AddAudit(entry models.AuditEntry) error {
+	params, err := encodeParams(entry.Params)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Exec(
+		`INSERT INTO audit
+		(chat_id, actor_id, target_id, action, params, created_at)
+		VALUES($1, $2, $3, $4, $5, $6)`,
+		entry.ChatId,
+		entry.ActorId,
+		entry.TargetId,
+		entry.Action,
+		params,
+		unixTime(entry.CreatedAt),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetAudit is a function which returns up to limit audit entries of
+// chatId (of all chats if chatId is zero) with id less than before (any
+// if before is zero), most recent first
+func (p *Postgres) GetAudit(chatId, before int64, limit int) ([]models.AuditEntry, error) {
+	rows, err := p.db.Query(
+		`SELECT id, chat_id, actor_id, target_id, action, params, created_at
+		FROM audit WHERE ($1::BIGINT=0 OR chat_id=$1) AND ($2::BIGINT=0 OR id<$2)
+		ORDER BY id DESC LIMIT $3`,
+		chatId,
+		before,
+		limit,
+	)
+	if err != nil {
+		return []models.AuditEntry{}, err
+	}
+	defer rows.Close()
+
+	return scanAudit(rows)
+}
+
+// AddAPIKey is a function which stores webserver API key scoped to its
+// chats
+func (p *Postgres) AddAPIKey(key models.APIKey) error {
+	if len(key.ChatIds) == 0 {
+		return ErrNoKeyChats
+	}
+
+	return transact(p.db, func(tx queryer) error {
+		res, err := tx.Exec(
+			`INSERT INTO api_keys VALUES($1, $2, $3, $4) ON CONFLICT (id) DO NOTHING`,
+			key.Id,
+			key.Secret,
+			unixTime(key.CreatedAt),
+			unixTime(key.ExpiresAt),
+		)
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return ErrAPIKeyExists
+		}
+
+		for _, chatId := range key.ChatIds {
+			_, err := tx.Exec(`INSERT INTO api_key_chats VALUES($1, $2) ON CONFLICT DO NOTHING`, key.Id, chatId)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetAPIKey is a function which returns API key by id. Returns
+// ErrUnknownAPIKey if there is no such key.
+func (p *Postgres) GetAPIKey(id string) (models.APIKey, error) {
+	rows, err := p.db.Query(apiKeysQuery+` WHERE k.id=$1 ORDER BY c.chat_id`, id)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	defer rows.Close()
+
+	keys, err := scanAPIKeys(rows)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	if len(keys) == 0 {
+		return models.APIKey{}, ErrUnknownAPIKey
+	}
+
+	return keys[0], nil
+}
+
+// GetAPIKeys is a function which returns API keys allowed to post
+// reactions of chatId (all keys if chatId is zero)
+func (p *Postgres) GetAPIKeys(chatId int64) ([]models.APIKey, error) {
+	rows, err := p.db.Query(
+		apiKeysQuery+` WHERE $1::BIGINT=0 OR k.id IN (SELECT key_id FROM api_key_chats WHERE chat_id=$1)
+		ORDER BY k.created_at, k.id, c.chat_id`,
+		chatId,
+	)
+	if err != nil {
+		return []models.APIKey{}, err
+	}
+	defer rows.Close()
+
+	return scanAPIKeys(rows)
+}
+
+// RemoveAPIKey is a function which revokes API key. Returns
+// ErrUnknownAPIKey if there is no such key.
+func (p *Postgres) RemoveAPIKey(id string) error {
+	return transact(p.db, func(tx queryer) error {
+		res, err := tx.Exec(`DELETE FROM api_keys WHERE id=$1`, id)
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return ErrUnknownAPIKey
+		}
+
+		_, err = tx.Exec(`DELETE FROM api_key_chats WHERE key_id=$1`, id)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// AddName is a function which records username and full name userId
+// was seen with in chatId at seen time
+func (p *Postgres) AddName(chatId, userId int64, username, fullName string, seen time.Time) error {
+	_, err := p.db.Exec(
+		`INSERT INTO names VALUES($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (chat_id, user_id, username, full_name) DO UPDATE SET
+			first_seen=LEAST(names.first_seen, excluded.first_seen),
+			last_seen=GREATEST(names.last_seen, excluded.last_seen)`,
+		chatId,
+		userId,
+		username,
+		fullName,
+		seen.Unix(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetNames is a function which returns names userId was seen with in
+// chatId, most recent first
+func (p *Postgres) GetNames(chatId, userId int64) ([]models.Name, error) {
+	rows, err := p.db.Query(
+		`SELECT username, full_name, first_seen, last_seen FROM names
+		WHERE chat_id=$1 AND user_id=$2 ORDER BY last_seen DESC`,
+		chatId,
+		userId,
+	)
+	if err != nil {
+		return []models.Name{}, err
+	}
+	defer rows.Close()
+
+	var names []models.Name
+
+	for rows.Next() {
+		name := models.Name{UserId: userId}
+
+		var firstSeen, lastSeen int64
+
+		err := rows.Scan(&name.Username, &name.FullName, &firstSeen, &lastSeen)
+		if err != nil {
+			return []models.Name{}, err
+		}
+
+		name.FirstSeen = seenTime(firstSeen)
+		name.LastSeen = seenTime(lastSeen)
+
+		names = append(names, name)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []models.Name{}, err
+	}
+
+	return names, nil
+}
+
+// GetLatestNames is a function which returns most recent names of
+// userIds in chatId with single query
+func (p *Postgres) GetLatestNames(chatId int64, userIds []int64) (map[int64]models.Name, error) {
+	rows, err := p.db.Query(
+		`SELECT DISTINCT ON (user_id)
+			user_id, username, full_name, first_seen, last_seen
+		FROM names WHERE chat_id=$1 AND user_id = ANY($2)
+		ORDER BY user_id, last_seen DESC`,
+		chatId,
+		pq.Array(userIds),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := map[int64]models.Name{}
+
+	for rows.Next() {
+		var (
+			name                models.Name
+			firstSeen, lastSeen int64
+		)
+
+		err := rows.Scan(&name.UserId, &name.Username, &name.FullName, &firstSeen, &lastSeen)
+		if err != nil {
+			return nil, err
+		}
+
+		name.FirstSeen = seenTime(firstSeen)
+		name.LastSeen = seenTime(lastSeen)
+
+		names[name.UserId] = name
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// FindUser is a function which returns id of user last seen with
+// username in chatId. Returns ErrUnknownUser if there is no such user.
+func (p *Postgres) FindUser(chatId int64, username string) (int64, error) {
+	var userId int64
+
+	err := p.db.QueryRow(
+		`SELECT user_id FROM names WHERE chat_id=$1 AND lower(username)=lower($2)
+		ORDER BY last_seen DESC LIMIT 1`,
+		chatId,
+		username,
+	).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrUnknownUser
+		}
+
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+// AddMessage is a function which remembers message author, so native
+// Telegram reaction updates (which lack author) can be attributed
+func (p *Postgres) AddMessage(chatId, messageId, userId int64, at time.Time) error {
+	_, err := p.db.Exec(
+		`INSERT INTO messages VALUES($1, $2, $3, $4)
+		ON CONFLICT (chat_id, message_id) DO UPDATE SET
+			user_id=EXCLUDED.user_id,
+			seen_at=EXCLUDED.seen_at`,
+		chatId,
+		messageId,
+		userId,
+		at.Unix(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if p.messages.Add(1)%messagePrune != 0 {
+		return nil
+	}
+
+	_, err = p.db.Exec(
+		"DELETE FROM messages WHERE seen_at<$1",
+		at.Add(-messageRetention).Unix(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetMessageAuthor is a function which returns author of messageId in chatId.
+// Returns ErrUnknownMessage if message was not seen before.
+func (p *Postgres) GetMessageAuthor(chatId, messageId int64) (int64, error) {
+	row := p.db.QueryRow(
+		"SELECT user_id FROM messages WHERE chat_id=$1 AND message_id=$2",
+		chatId,
+		messageId,
+	)
+
+	var userId int64
+	err := row.Scan(&userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrUnknownMessage
+		}
+
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+// GetReactionMap is a function which returns reaction -> category map
+// used in chatId (registry defaults with chat overrides)
+func (p *Postgres) GetReactionMap(chatId int64) (map[string]string, error) {
+	rows, err := p.db.Query(
+		"SELECT reaction, category FROM reaction_map WHERE chat_id=$1",
+		chatId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := map[string]string{}
+
+	for rows.Next() {
+		var reaction, category string
+
+		err := rows.Scan(&reaction, &category)
+		if err != nil {
+			return nil, err
+		}
+
+		overrides[reaction] = category
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.registry.Merge(overrides), nil
+}
+
+// SetReactionCategory is a function which overrides reaction category
+// in chatId
+func (p *Postgres) SetReactionCategory(chatId int64, reaction, category string) error {
+	_, err := p.db.Exec(
+		`INSERT INTO reaction_map VALUES($1, $2, $3)
+		ON CONFLICT (chat_id, reaction) DO UPDATE SET category=EXCLUDED.category`,
+		chatId,
+		reaction,
+		category,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ResetReactionCategory is a function which drops chatId override of
+// reaction category
+func (p *Postgres) ResetReactionCategory(chatId int64, reaction string) error {
+	_, err := p.db.Exec(
+		"DELETE FROM reaction_map WHERE chat_id=$1 AND reaction=$2",
+		chatId,
+		reaction,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetWeights is a function which returns category -> score weight map
+// used in chatId (defaults with chat overrides)
+func (p *Postgres) GetWeights(chatId int64) (map[string]float64, error) {
+	rows, err := p.db.Query(
+		"SELECT category, weight FROM weights WHERE chat_id=$1",
+		chatId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := map[string]float64{}
+
+	for rows.Next() {
+		var category string
+		var weight float64
+
+		err := rows.Scan(&category, &weight)
+		if err != nil {
+			return nil, err
+		}
+
+		overrides[category] = weight
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeWeights(overrides), nil
+}
+
+// SetWeight is a function which overrides category score weight in chatId
+func (p *Postgres) SetWeight(chatId int64, category string, weight float64) error {
+	_, err := p.db.Exec(
+		`INSERT INTO weights VALUES($1, $2, $3)
+		ON CONFLICT (chat_id, category) DO UPDATE SET weight=EXCLUDED.weight`,
+		chatId,
+		category,
+		weight,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ResetWeight is a function which drops chatId override of category
+// score weight
+func (p *Postgres) ResetWeight(chatId int64, category string) error {
+	_, err := p.db.Exec(
+		"DELETE FROM weights WHERE chat_id=$1 AND category=$2",
+		chatId,
+		category,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetRateLimit is a function which returns reactions rate limit policy
+// used in chatId, DefaultRateLimit unless chat overrides it
+func (p *Postgres) GetRateLimit(chatId int64) (RateLimit, error) {
+	var window int64
+
+	policy := RateLimit{}
+
+	err := p.db.QueryRow(
+		`SELECT window_seconds, burst, daily, per_receiver FROM rate_limits
+		WHERE chat_id=$1`,
+		chatId,
+	).Scan(&window, &policy.Burst, &policy.Daily, &policy.PerReceiver)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return DefaultRateLimit, nil
+		}
+
+		return RateLimit{}, err
+	}
+
+	policy.Window = time.Duration(window) * time.Second
+
+	return policy, nil
+}
+
+// SetRateLimit is a function which overrides reactions rate limit
+// policy in chatId
+func (p *Postgres) SetRateLimit(chatId int64, policy RateLimit) error {
+	_, err := p.db.Exec(
+		`INSERT INTO rate_limits VALUES($1, $2, $3, $4, $5)
+		ON CONFLICT (chat_id) DO UPDATE SET
+			window_seconds=excluded.window_seconds,
+			burst=excluded.burst,
+			daily=excluded.daily,
+			per_receiver=excluded.per_receiver`,
+		chatId,
+		int64(policy.Window/time.Second),
+		policy.Burst,
+		policy.Daily,
+		policy.PerReceiver,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ResetRateLimit is a function which drops chatId override of
+// reactions rate limit policy
+func (p *Postgres) ResetRateLimit(chatId int64) error {
+	_, err := p.db.Exec("DELETE FROM rate_limits WHERE chat_id=$1", chatId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Close is a function which closes cooldowns and database connection pool
+func (p *Postgres) Close() error {
+	p.cooldowns.Close()
+
+	return p.pool.Close()
+}
+
+// Batch is a function which runs items in single transaction
+func (p *Postgres) Batch(items []BatchItem, opts BatchOpts) ([]error, error) {
+	return batchItems(p, items, opts)
+}
+
+// BatchStream is a function which runs items next returns in single
+// transaction. Its reactions share rate limit with reactions outside of
+// batch, which wait until it ends (unless batch has cooldowns of its
+// own or none).
+func (p *Postgres) BatchStream(next func() BatchItem, report func(err error), opts BatchOpts) error {
+	// Limiter is locked before transaction begins, as reactions
+	// outside of batch lock it first too
+	if !opts.NoCooldowns && opts.Cooldowns == nil {
+		p.limiter.mux.Lock()
+		defer p.limiter.mux.Unlock()
+	}
+
+	tx, err := p.pool.Begin()
+	if err != nil {
+		return err
+	}
+
+	bound := *p
+	bound.db = tx
+	bound.cooldowns = p.cooldowns.bind(tx)
+	bound.limiter = NewLimiter(bound.cooldowns)
+
+	switch {
+	case opts.NoCooldowns:
+		bound.limiter = nil
+	case opts.Cooldowns != nil:
+		bound.limiter = NewLimiter(opts.Cooldowns)
+	}
+
+	return runBatch(tx, &bound, next, report, opts)
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/exp/slog"
+	"sync"
+	"time"
+)
+
+// Rate limit errors, they are reasons reactions are dropped with
+var (
+	ErrBurstLimit = errors.New("too many reactions in window")
+	ErrDailyLimit = errors.New("too many reactions today")
+)
+
+// RateLimit is a policy reactions givers are limited with in chat
+type RateLimit struct {
+	// Window is a period Burst is counted in
+	Window time.Duration
+
+	// Burst is a number of reactions giver can give in Window,
+	// zero means no limit
+	Burst int
+
+	// Daily is a number of reactions giver can give in UTC day,
+	// zero means no limit
+	Daily int
+
+	// PerReceiver makes Burst count reactions of giver to every
+	// receiver separately, Daily is always counted per giver
+	PerReceiver bool
+}
+
+// DefaultRateLimit is a policy used unless chat overrides it
+var DefaultRateLimit = RateLimit{
+	Window: time.Minute,
+	Burst:  10,
+}
+
+// cooldownCapacity is a number of keys in-memory cooldowns keep
+const cooldownCapacity = 100000
+
+// Limiter is a reactions rate limiter, it counts reactions accepted
+// in window and in their UTC day in CooldownStore
+type Limiter struct {
+	cooldowns CooldownStore
+
+	// mux is sync.Mutex which makes counting and registering reaction
+	// atomic
+	mux sync.Mutex
+}
+
+// NewLimiter is a function which creates Limiter counting reactions in
+// cooldowns
+func NewLimiter(cooldowns CooldownStore) *Limiter {
+	return &Limiter{cooldowns: cooldowns}
+}
+
+// Allow is a function which registers reaction of fromUserId to userId
+// in chatId made at time, window and day are counted from it. Returns
+// ErrBurstLimit or ErrDailyLimit if policy drops it, dropped reactions
+// are not counted.
+func (l *Limiter) Allow(chatId, fromUserId, userId int64, policy RateLimit, at time.Time) error {
+	// Nothing is counted without limits
+	if policy.Burst == 0 && policy.Daily == 0 {
+		return nil
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	// Burst is counted per giver or per pair, daily is always per giver
+	var receiver int64
+	if policy.PerReceiver {
+		receiver = userId
+	}
+
+	burstKey := fmt.Sprintf("burst:%v:%v:%v", chatId, fromUserId, receiver)
+	dailyKey := fmt.Sprintf("daily:%v:%v", chatId, fromUserId)
+
+	today := at.UTC().Truncate(24 * time.Hour)
+
+	if policy.Daily > 0 {
+		hits, err := l.cooldowns.Hits(dailyKey, today)
+		if err != nil {
+			return err
+		}
+
+		if hits >= policy.Daily {
+			return ErrDailyLimit
+		}
+	}
+
+	if policy.Burst > 0 {
+		hits, err := l.cooldowns.Hits(burstKey, at.Add(-policy.Window))
+		if err != nil {
+			return err
+		}
+
+		if hits >= policy.Burst {
+			return ErrBurstLimit
+		}
+	}
+
+	// Burst hits are needed while they are in window, daily ones until
+	// day ends. Disabled limits are not hit.
+	if policy.Burst > 0 {
+		err := l.cooldowns.Hit(burstKey, at, at.Add(policy.Window))
+		if err != nil {
+			return err
+		}
+	}
+
+	if policy.Daily > 0 {
+		err := l.cooldowns.Hit(dailyKey, at, today.Add(24*time.Hour))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// drop is a function which registers reaction in limiter and reports
+// whether it should be dropped, dropped reactions are logged. Nil
+// limiter drops nothing.
+func (l *Limiter) drop(chatId, fromUserId, userId int64, policy RateLimit, at time.Time) (bool, error) {
+	if l == nil {
+		return false, nil
+	}
+
+	err := l.Allow(chatId, fromUserId, userId, policy, at)
+	if err == nil {
+		return false, nil
+	}
+
+	if !errors.Is(err, ErrBurstLimit) && !errors.Is(err, ErrDailyLimit) {
+		return false, err
+	}
+
+	slog.Info(
+		"Reaction dropped",
+		slog.Int64("chat_id", chatId),
+		slog.Int64("from_user_id", fromUserId),
+		slog.Int64("user_id", userId),
+		slog.String("reason", err.Error()),
+	)
+
+	return true, nil
+}
@@ -0,0 +1,500 @@
+package database
+
+import (
+	"errors"
+	"golang.org/x/exp/slices"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock tests move by hand
+type fakeClock struct {
+	now time.Time
+}
+
+// Now is a function which returns current fake time
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// newFakeClock is a function which creates fakeClock standing at
+// 2024-01-01 23:00 UTC, an hour before day ends
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)}
+}
+
+func TestMemoryCooldownsExpiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		advance time.Duration
+		from    time.Duration
+		want    int
+	}{
+		{"alive", time.Minute, 30 * time.Second, -time.Hour, 2},
+		{"one expired", time.Minute, time.Minute, -time.Hour, 1},
+		{"expired", time.Minute, time.Minute + time.Second, -time.Hour, 0},
+		{"long ttl", time.Hour, 59 * time.Minute, -time.Hour, 2},
+		{"counted since from", time.Hour, time.Minute, 0, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := newFakeClock()
+			start := clock.now
+			cooldowns := NewMemoryCooldowns(10, clock.Now)
+
+			// Hits are made a second apart, from is relative to the
+			// second one
+			for i := 0; i < 2; i++ {
+				at := start.Add(time.Duration(i) * time.Second)
+
+				err := cooldowns.Hit("key", at, at.Add(test.ttl))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			clock.now = clock.now.Add(test.advance)
+
+			hits, err := cooldowns.Hits("key", start.Add(time.Second+test.from))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if hits != test.want {
+				t.Errorf("Hits = %v, want %v", hits, test.want)
+			}
+		})
+	}
+}
+
+func TestMemoryCooldownsEviction(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// keys are hit in order, read keys are read after that
+		keys    []string
+		read    []string
+		last    string
+		evicted string
+	}{
+		{"oldest", []string{"a", "b"}, nil, "c", "a"},
+		{"read is used", []string{"a", "b"}, []string{"a"}, "c", "b"},
+		{"hit is used", []string{"a", "b", "a"}, nil, "c", "b"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := newFakeClock()
+			cooldowns := NewMemoryCooldowns(2, clock.Now)
+			expires := clock.now.Add(time.Hour)
+
+			for _, key := range test.keys {
+				err := cooldowns.Hit(key, clock.now, expires)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, key := range test.read {
+				_, err := cooldowns.Hits(key, time.Time{})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := cooldowns.Hit(test.last, clock.now, expires)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, key := range append(test.keys, test.last) {
+				hits, err := cooldowns.Hits(key, time.Time{})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if evicted := hits == 0; evicted != (key == test.evicted) {
+					t.Errorf("key %v evicted = %v", key, evicted)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	// step is a reaction of giver to receiver made after advance
+	type step struct {
+		advance  time.Duration
+		giver    int64
+		receiver int64
+		want     error
+	}
+
+	tests := []struct {
+		name   string
+		policy RateLimit
+		steps  []step
+	}{
+		{
+			"burst",
+			RateLimit{Window: time.Minute, Burst: 2},
+			[]step{
+				{0, 1, 2, nil},
+				{0, 1, 3, nil},
+				{0, 1, 4, ErrBurstLimit},
+				{0, 5, 2, nil},
+			},
+		},
+		{
+			"burst refill",
+			RateLimit{Window: time.Minute, Burst: 2},
+			[]step{
+				{0, 1, 2, nil},
+				{30 * time.Second, 1, 2, nil},
+				{0, 1, 2, ErrBurstLimit},
+				{30 * time.Second, 1, 2, nil},
+				{0, 1, 2, ErrBurstLimit},
+				{time.Minute, 1, 2, nil},
+				{0, 1, 2, nil},
+			},
+		},
+		{
+			"burst per receiver",
+			RateLimit{Window: time.Minute, Burst: 1, PerReceiver: true},
+			[]step{
+				{0, 1, 2, nil},
+				{0, 1, 3, nil},
+				{0, 1, 2, ErrBurstLimit},
+			},
+		},
+		{
+			"daily rollover",
+			RateLimit{Window: time.Minute, Daily: 2},
+			[]step{
+				{0, 1, 2, nil},
+				{10 * time.Minute, 1, 2, nil},
+				{10 * time.Minute, 1, 2, ErrDailyLimit},
+				{39*time.Minute + 59*time.Second, 1, 2, ErrDailyLimit},
+				{time.Second, 1, 2, nil},
+				{0, 1, 2, nil},
+				{0, 1, 2, ErrDailyLimit},
+			},
+		},
+		{
+			"dropped reactions are not counted",
+			RateLimit{Window: time.Minute, Burst: 1, Daily: 2},
+			[]step{
+				{0, 1, 2, nil},
+				{0, 1, 2, ErrBurstLimit},
+				{0, 1, 2, ErrBurstLimit},
+				{time.Minute, 1, 2, nil},
+				{time.Minute, 1, 2, ErrDailyLimit},
+			},
+		},
+		{
+			"no limits",
+			RateLimit{Window: time.Minute},
+			[]step{
+				{0, 1, 2, nil},
+				{0, 1, 2, nil},
+				{0, 1, 2, nil},
+			},
+		},
+	}
+
+	for backend, open := range cooldownBackends {
+		for _, test := range tests {
+			t.Run(backend+"/"+test.name, func(t *testing.T) {
+				clock := newFakeClock()
+				reopen := open(t, clock.Now)
+
+				for i, step := range test.steps {
+					clock.now = clock.now.Add(step.advance)
+
+					// Cooldowns are reopened before every step, as if
+					// bot was restarted in the middle of window
+					limiter := NewLimiter(reopen())
+
+					err := limiter.Allow(1, step.giver, step.receiver, test.policy, clock.Now())
+					if !errors.Is(err, step.want) {
+						t.Errorf("step %v at %v: Allow = %v, want %v", i, clock.now.Format(time.TimeOnly), err, step.want)
+					}
+				}
+			})
+		}
+	}
+}
+
+// cooldownBackends are CooldownStore backends limiter is tested with,
+// they return function which reopens cooldowns (persistent ones are
+// closed and opened again, in-memory ones are kept as is)
+var cooldownBackends = map[string]func(t *testing.T, clock Clock) func() CooldownStore{
+	"memory": func(t *testing.T, clock Clock) func() CooldownStore {
+		cooldowns := NewMemoryCooldowns(100, clock)
+
+		return func() CooldownStore {
+			return cooldowns
+		}
+	},
+	"sqlite": func(t *testing.T, clock Clock) func() CooldownStore {
+		path := filepath.Join(t.TempDir(), "cooldowns.db")
+
+		var (
+			store     *SQLite
+			cooldowns *SQLCooldowns
+		)
+
+		closeAll := func() {
+			if cooldowns != nil {
+				cooldowns.Close()
+				store.Close()
+			}
+		}
+		t.Cleanup(closeAll)
+
+		return func() CooldownStore {
+			closeAll()
+
+			var err error
+
+			store, err = NewSQLite(path, DefaultRegistry())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cooldowns, err = NewSQLCooldowns(store.pool, "sqlite", clock)
+			if err != nil {
+				store.Close()
+				t.Fatal(err)
+			}
+
+			return cooldowns
+		}
+	},
+}
+
+// Expired hits are swept by cooldowns clock, not by wall clock
+func TestSQLCooldownsSweep(t *testing.T) {
+	clock := newFakeClock()
+
+	store, err := NewSQLite(filepath.Join(t.TempDir(), "cooldowns.db"), DefaultRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	cooldowns, err := NewSQLCooldowns(store.pool, "sqlite", clock.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cooldowns.Close()
+
+	err = cooldowns.Hit("old", clock.now, clock.now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.now = clock.now.Add(2 * time.Minute)
+
+	for i := 1; i < cooldownSweep; i++ {
+		err := cooldowns.Hit("new", clock.now, clock.now.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"old", 0},
+		{"new", cooldownSweep - 1},
+	}
+
+	for _, test := range tests {
+		var rows int
+
+		err := store.pool.QueryRow(`SELECT COUNT(*) FROM cooldowns WHERE key=?`, test.key).Scan(&rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rows != test.want {
+			t.Errorf("%v rows = %v, want %v", test.key, rows, test.want)
+		}
+	}
+}
+
+// Disabled limits keep no hits
+func TestLimiterDisabledHits(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RateLimit
+		want   []string
+	}{
+		{"no limits", RateLimit{Window: time.Minute}, nil},
+		{"burst", RateLimit{Window: time.Minute, Burst: 1}, []string{"burst:1:1:0"}},
+		{"daily", RateLimit{Window: time.Minute, Daily: 1}, []string{"daily:1:1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := newFakeClock()
+			cooldowns := NewMemoryCooldowns(100, clock.Now)
+
+			err := NewLimiter(cooldowns).Allow(1, 1, 2, test.policy, clock.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var keys []string
+			for key := range cooldowns.entries {
+				keys = append(keys, key)
+			}
+
+			if !slices.Equal(keys, test.want) {
+				t.Errorf("keys = %v, want %v", keys, test.want)
+			}
+		})
+	}
+}
+
+// Reactions of batch and live ones made while it runs share rate limit
+func TestBatchSharesLimit(t *testing.T) {
+	like := ReactionKey("👍", "")
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			chatId := -time.Now().UnixNano()
+
+			err := store.SetRateLimit(chatId, RateLimit{Window: time.Hour, Burst: 3})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			started := make(chan struct{})
+			live := make(chan error)
+
+			// Batch takes whole burst, live reactions are made after its
+			// first reaction
+			item := func(messageId int64) BatchItem {
+				return func(store Store) error {
+					err := store.AddReaction(chatId, 1, 2, messageId, like, time.Now())
+					if err != nil {
+						return err
+					}
+
+					if messageId == 1 {
+						close(started)
+					}
+
+					time.Sleep(50 * time.Millisecond)
+
+					return nil
+				}
+			}
+
+			go func() {
+				<-started
+
+				for messageId := int64(11); messageId <= 13; messageId++ {
+					err := store.AddReaction(chatId, 1, 2, messageId, like, time.Now())
+					if err != nil {
+						live <- err
+						return
+					}
+				}
+
+				live <- nil
+			}()
+
+			errs, err := store.Batch([]BatchItem{item(1), item(2), item(3)}, BatchOpts{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = <-live
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user, err := store.GetUserRating(chatId, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if user.Reactions[CategoryLike] != 3 {
+				t.Errorf("likes = %v, want 3", user.Reactions[CategoryLike])
+			}
+		})
+	}
+}
+
+func TestBatchReplayCooldowns(t *testing.T) {
+	like := ReactionKey("👍", "")
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			chatId := -time.Now().UnixNano()
+
+			err := store.SetRateLimit(chatId, RateLimit{Window: time.Hour, Burst: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Replayed reactions are limited by their own time, third
+			// one is in window of first two, fourth is not
+			clock := newFakeClock()
+			offsets := []time.Duration{0, time.Minute, 2 * time.Minute, 2 * time.Hour}
+
+			var items []BatchItem
+			for i, offset := range offsets {
+				messageId, at := int64(i+1), clock.now.Add(offset)
+
+				items = append(items, func(store Store) error {
+					clock.now = at
+					return store.AddReaction(chatId, 1, 2, messageId, like, at)
+				})
+			}
+
+			errs, err := store.Batch(items, BatchOpts{
+				Cooldowns: NewMemoryCooldowns(100, clock.Now),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Live burst is left untouched by replay
+			for messageId := int64(11); messageId <= 12; messageId++ {
+				err := store.AddReaction(chatId, 1, 2, messageId, like, time.Now())
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			user, err := store.GetUserRating(chatId, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if user.Reactions[CategoryLike] != 5 {
+				t.Errorf("likes = %v, want 5", user.Reactions[CategoryLike])
+			}
+		})
+	}
+}
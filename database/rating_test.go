@@ -0,0 +1,236 @@
+package database
+
+import (
+	"errors"
+	"github.com/xbt573/flood-social-rep/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testStores is a function which opens every store backend for test:
+// memory, SQLite in temporary directory and PostgreSQL if TEST_POSTGRES
+// is set to its DSN
+func testStores(t testing.TB) map[string]Store {
+	t.Helper()
+
+	stores := map[string]Store{"memory": NewMemory(DefaultRegistry())}
+
+	sqlite, err := NewSQLite(filepath.Join(t.TempDir(), "test.db"), DefaultRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores["sqlite"] = sqlite
+
+	if dsn, exists := os.LookupEnv("TEST_POSTGRES"); exists {
+		postgres, err := NewPostgres(dsn, DefaultRegistry())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stores["postgres"] = postgres
+	}
+
+	t.Cleanup(func() {
+		for _, store := range stores {
+			store.Close()
+		}
+	})
+
+	return stores
+}
+
+// Reactions made in the same second as rating reset, but after it, are
+// counted
+func TestResetSameSecond(t *testing.T) {
+	like := ReactionKey("👍", "")
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			// Chat is unique per backend run, so PostgreSQL data of
+			// previous runs doesn't matter
+			chatId := -time.Now().UnixNano()
+
+			err := store.AddReaction(chatId, 2, 1, 1, like, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = store.AddAdjustment(chatId, models.Adjustment{
+				UserId:    1,
+				Reset:     true,
+				CreatedAt: time.Now(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = store.AddReaction(chatId, 3, 1, 2, like, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = store.AddAdjustment(chatId, models.Adjustment{
+				UserId:    1,
+				Category:  CategoryLike,
+				Amount:    2,
+				CreatedAt: time.Now(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user, err := store.GetUserRating(chatId, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if user.Reactions[CategoryLike] != 3 {
+				t.Errorf("GetUserRating likes = %v, want 3", user.Reactions[CategoryLike])
+			}
+
+			top, err := store.TopRating(chatId, AllTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(top) != 1 || top[0].Reactions[CategoryLike] != 3 {
+				t.Errorf("TopRating = %+v, want one user with 3 likes", top)
+			}
+		})
+	}
+}
+
+// Reactions are counted in windows by time they were made at, not by
+// time they were stored at
+func TestReactionTime(t *testing.T) {
+	like := ReactionKey("👍", "")
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		window Window
+		want   int
+	}{
+		{"all time", AllTime, 2},
+		{"today", Window{From: now.Add(-time.Hour)}, 1},
+		{"two days ago", Window{From: now.Add(-49 * time.Hour), To: now.Add(-47 * time.Hour)}, 1},
+	}
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			chatId := -time.Now().UnixNano()
+
+			err := store.AddReaction(chatId, 2, 1, 1, like, now.Add(-48*time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = store.AddReaction(chatId, 2, 1, 2, like, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, test := range tests {
+				top, err := store.TopRating(chatId, test.window)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(top) != 1 || top[0].Reactions[CategoryLike] != test.want {
+					t.Errorf("%v: TopRating = %+v, want one user with %v likes", test.name, top, test.want)
+				}
+			}
+		})
+	}
+}
+
+// Authors of messages not seen for retention period are forgotten,
+// fresh ones are kept
+func TestMessageRetention(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			chatId := -time.Now().UnixNano()
+			now := time.Now()
+
+			err := store.AddMessage(chatId, 1, 10, now.Add(-messageRetention-time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for messageId := int64(2); messageId <= messagePrune; messageId++ {
+				err := store.AddMessage(chatId, messageId, 20, now)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err = store.GetMessageAuthor(chatId, 1)
+			if !errors.Is(err, ErrUnknownMessage) {
+				t.Errorf("old message err = %v, want %v", err, ErrUnknownMessage)
+			}
+
+			userId, err := store.GetMessageAuthor(chatId, messagePrune)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if userId != 20 {
+				t.Errorf("author = %v, want 20", userId)
+			}
+		})
+	}
+}
+
+// Blacklist is checked at time reaction was made: reactions made while
+// entry is in force are skipped, ones made after it expires are counted
+func TestBlacklistAtReactionTime(t *testing.T) {
+	like := ReactionKey("👍", "")
+	now := time.Now()
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			chatId := -time.Now().UnixNano()
+
+			err := store.AddBlacklist(chatId, models.BlacklistEntry{
+				UserId:    1,
+				Mode:      BlacklistReceive,
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = store.AddReaction(chatId, 2, 1, 1, like, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = store.AddReaction(chatId, 2, 1, 2, like, now.Add(2*time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reactions, err := store.GetReactions(chatId, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(reactions) != 0 {
+				t.Errorf("reactions made while ignored = %v, want none", reactions)
+			}
+
+			reactions, err = store.GetReactions(chatId, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(reactions) != 1 {
+				t.Errorf("reactions made after ignore expired = %v, want 1", reactions)
+			}
+		})
+	}
+}
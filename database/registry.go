@@ -0,0 +1,117 @@
+package database
+
+import (
+	"encoding/json"
+	"golang.org/x/exp/maps"
+	"os"
+)
+
+// Built-in rating categories
+const (
+	CategoryLike    = "like"
+	CategoryDislike = "dislike"
+	CategoryWhale   = "whale"
+)
+
+// CategoryNone is a category of reactions which are not rated,
+// used by chats to switch off default reactions
+const CategoryNone = "none"
+
+// defaultWeights is a category -> score weight map used unless chat
+// overrides it
+var defaultWeights = map[string]float64{
+	CategoryLike:    1,
+	CategoryDislike: -1,
+	CategoryWhale:   0.5,
+}
+
+// customEmojiPrefix is a prefix of custom emoji reaction keys
+const customEmojiPrefix = "custom:"
+
+// Registry is a reaction to rating category mapping used by default,
+// chats can override it in store
+type Registry struct {
+	// defaults is a reaction -> category map
+	defaults map[string]string
+}
+
+// NewRegistry is a function which creates Registry from
+// category -> reactions map
+func NewRegistry(categories map[string][]string) *Registry {
+	defaults := map[string]string{}
+
+	for category, reactions := range categories {
+		for _, reaction := range reactions {
+			defaults[reaction] = category
+		}
+	}
+
+	return &Registry{defaults: defaults}
+}
+
+// DefaultRegistry is a function which creates Registry with
+// built-in reaction mapping
+func DefaultRegistry() *Registry {
+	return NewRegistry(map[string][]string{
+		CategoryLike:    {"👍", "🔥", "❤", "❤‍🔥", "👏", "💯"},
+		CategoryDislike: {"🤡", "💩", "🤮", "👎"},
+		CategoryWhale:   {"🐳"}, // whale bruh
+	})
+}
+
+// LoadRegistry is a function which loads Registry from JSON file
+// with category -> reactions object
+func LoadRegistry(path string) (*Registry, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var categories map[string][]string
+
+	err = json.Unmarshal(content, &categories)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRegistry(categories), nil
+}
+
+// Merge is a function which returns default mapping with chat
+// overrides applied, reactions overridden with CategoryNone are dropped
+func (r *Registry) Merge(overrides map[string]string) map[string]string {
+	merged := maps.Clone(r.defaults)
+
+	for reaction, category := range overrides {
+		if category == CategoryNone {
+			delete(merged, reaction)
+			continue
+		}
+
+		merged[reaction] = category
+	}
+
+	return merged
+}
+
+// mergeWeights is a function which returns default weights with chat
+// overrides applied
+func mergeWeights(overrides map[string]float64) map[string]float64 {
+	merged := maps.Clone(defaultWeights)
+
+	for category, weight := range overrides {
+		merged[category] = weight
+	}
+
+	return merged
+}
+
+// ReactionKey is a function which returns key reaction is stored with,
+// emoji itself or "custom:<id>" for custom emojis
+func ReactionKey(emoji, customEmojiId string) string {
+	if customEmojiId != "" {
+		return customEmojiPrefix + customEmojiId
+	}
+
+	return emoji
+}
@@ -0,0 +1,1358 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	_ "github.com/mattn/go-sqlite3" // side-effect import
+	"github.com/xbt573/flood-social-rep/models"
+	"golang.org/x/exp/maps"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SQLite is a Store which keeps everything in SQLite database file
+type SQLite struct {
+	// pool is a long-lived connection pool, db is a pool or batch
+	// transaction queries are run in
+	pool *sql.DB
+	db   queryer
+
+	// registry is a default reaction mapping
+	registry *Registry
+
+	// limiter is a reactions rate limiter, it keeps hits in cooldowns
+	limiter   *Limiter
+	cooldowns *SQLCooldowns
+
+	// messages is a number of remembered messages, old ones are pruned
+	// every messagePrune of them
+	messages *atomic.Int64
+
+	// Prepared statements
+	topRating        *sql.Stmt
+	userRating       *sql.Stmt
+	topAdjustments   *sql.Stmt
+	userAdjustments  *sql.Stmt
+	isBlacklisted    *sql.Stmt
+	hasReaction      *sql.Stmt
+	addReaction      *sql.Stmt
+	removeReaction   *sql.Stmt
+	getReactions     *sql.Stmt
+	addBlacklist     *sql.Stmt
+	removeBlacklist  *sql.Stmt
+	getBlacklist     *sql.Stmt
+	addModerator     *sql.Stmt
+	removeModerator  *sql.Stmt
+	getModerators    *sql.Stmt
+	isModerator      *sql.Stmt
+	addAdjustment    *sql.Stmt
+	getAdjustments   *sql.Stmt
+	addAudit         *sql.Stmt
+	getAudit         *sql.Stmt
+	addName          *sql.Stmt
+	getNames         *sql.Stmt
+	findUser         *sql.Stmt
+	addMessage       *sql.Stmt
+	getMessageAuthor *sql.Stmt
+	pruneMessages    *sql.Stmt
+	getReactionMap   *sql.Stmt
+	setCategory      *sql.Stmt
+	resetCategory    *sql.Stmt
+	getWeights       *sql.Stmt
+	setWeight        *sql.Stmt
+	resetWeight      *sql.Stmt
+	getRateLimit     *sql.Stmt
+	setRateLimit     *sql.Stmt
+	resetRateLimit   *sql.Stmt
+}
+
+// NewSQLite is a function which opens SQLite database at path and
+// initializes it for first time use (if was not initialized before).
+// Database is opened in WAL mode, so readers don't block writers.
+// Returns non-nil error if something goes wrong!
+func NewSQLite(path string, registry *Registry) (*SQLite, error) {
+	db, err := sql.Open("sqlite3", sqliteSource(path))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SQLite{pool: db, db: db, registry: registry, messages: &atomic.Int64{}}
+
+	err = s.init()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	err = s.prepare()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	s.cooldowns, err = NewSQLCooldowns(db, "sqlite", time.Now)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	s.limiter = NewLimiter(s.cooldowns)
+
+	return s, nil
+}
+
+// sqliteSource is a function which builds driver data source for path
+// with WAL mode and busy timeout
+func sqliteSource(path string) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	return "file:" + path + separator + "_journal_mode=WAL&_busy_timeout=5000"
+}
+
+// init is a function which applies pending schema migrations
+func (s *SQLite) init() error {
+	migrator, err := NewMigrator(s.pool, "sqlite")
+	if err != nil {
+		return err
+	}
+
+	return migrator.Up()
+}
+
+// statements is a function which returns all statements used by store
+// with their queries
+func (s *SQLite) statements() []struct {
+	stmt  **sql.Stmt
+	query string
+} {
+	return []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{
+			// reactions user got before rating reset are not counted
+			&s.topRating,
+			`SELECT user_id, reaction FROM reactions r
+			WHERE chat_id=?1 AND created_at >= ?2 AND created_at < ?3
+			AND created_at_ns > COALESCE((SELECT MAX(created_at_ns) FROM adjustments
+				WHERE chat_id=?1 AND user_id=r.user_id AND is_reset=1), -1)`,
+		},
+		{
+			&s.userRating,
+			`SELECT reaction FROM reactions WHERE chat_id=?1 AND user_id=?2
+			AND created_at_ns > COALESCE((SELECT MAX(created_at_ns) FROM adjustments
+				WHERE chat_id=?1 AND user_id=?2 AND is_reset=1), -1)`,
+		},
+		{
+			&s.topAdjustments,
+			`SELECT user_id, category, amount FROM adjustments a
+			WHERE chat_id=?1 AND is_reset=0 AND created_at >= ?2 AND created_at < ?3
+			AND id > COALESCE((SELECT MAX(id) FROM adjustments
+				WHERE chat_id=?1 AND user_id=a.user_id AND is_reset=1), 0)`,
+		},
+		{
+			&s.userAdjustments,
+			`SELECT category, amount FROM adjustments
+			WHERE chat_id=?1 AND user_id=?2 AND is_reset=0
+			AND id > COALESCE((SELECT MAX(id) FROM adjustments
+				WHERE chat_id=?1 AND user_id=?2 AND is_reset=1), 0)`,
+		},
+		{
+			&s.isBlacklisted,
+			`SELECT EXISTS(SELECT 1 FROM blacklist WHERE chat_id=?1
+			AND (
+				(user_id=?2 AND mode IN ('receive', 'both')) OR
+				(user_id=?3 AND mode IN ('give', 'both'))
+			)
+			AND (expires_at=0 OR expires_at>?4))`,
+		},
+		{
+			&s.hasReaction,
+			`SELECT EXISTS(SELECT 1 FROM reactions WHERE chat_id=? AND from_user_id=?
+			AND user_id=? AND message_id=? AND reaction=?)`,
+		},
+		{
+			// ignore constraint error 🐳
+			&s.addReaction,
+			`INSERT OR IGNORE INTO reactions
+			(chat_id, from_user_id, user_id, message_id, reaction, created_at, created_at_ns)
+			VALUES(?, ?, ?, ?, ?, ?, ?)`,
+		},
+		{
+			&s.removeReaction,
+			`DELETE FROM reactions
+			WHERE chat_id=? AND from_user_id=? AND message_id=? AND reaction=?`,
+		},
+		{
+			&s.getReactions,
+			`SELECT from_user_id, reaction FROM reactions WHERE chat_id=? AND message_id=?`,
+		},
+		{
+			&s.addBlacklist,
+			// expired entry is replaced, active one is kept
+			`INSERT INTO blacklist
+			(chat_id, user_id, actor_id, reason, created_at, expires_at, mode)
+			VALUES(?1, ?2, ?3, ?4, ?5, ?6, ?8)
+			ON CONFLICT(chat_id, user_id) DO UPDATE SET
+				mode=excluded.mode,
+				actor_id=excluded.actor_id,
+				reason=excluded.reason,
+				created_at=excluded.created_at,
+				expires_at=excluded.expires_at
+			WHERE blacklist.expires_at!=0 AND blacklist.expires_at<=?7`,
+		},
+		{
+			&s.removeBlacklist,
+			`DELETE FROM blacklist WHERE chat_id=? AND user_id=?
+			AND (expires_at=0 OR expires_at>?)`,
+		},
+		{
+			&s.getBlacklist,
+			`SELECT user_id, mode, actor_id, reason, created_at, expires_at FROM blacklist
+			WHERE chat_id=? AND (expires_at=0 OR expires_at>?) ORDER BY created_at`,
+		},
+		{
+			&s.addModerator,
+			`INSERT OR IGNORE INTO moderators VALUES(?, ?, ?, ?)`,
+		},
+		{
+			&s.removeModerator,
+			`DELETE FROM moderators WHERE chat_id=? AND user_id=?`,
+		},
+		{
+			&s.getModerators,
+			`SELECT user_id, actor_id, created_at FROM moderators
+			WHERE chat_id=? ORDER BY created_at`,
+		},
+		{
+			&s.isModerator,
+			`SELECT EXISTS(SELECT 1 FROM moderators WHERE chat_id=? AND user_id=?)`,
+		},
+		{
+			&s.addAdjustment,
+			`INSERT INTO adjustments
+			(chat_id, user_id, actor_id, category, amount, is_reset, reason, created_at, created_at_ns)
+			VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		},
+		{
+			&s.getAdjustments,
+			`SELECT id, user_id, actor_id, category, amount, is_reset, reason, created_at
+			FROM adjustments WHERE chat_id=?1 AND (?2=0 OR user_id=?2)
+			ORDER BY id DESC LIMIT ?3`,
+		},
+		{
+			&s.addAudit,
+			`INSERT INTO audit
+			(chat_id, actor_id, target_id, action, params, created_at)
+			VALUES(?, ?, ?, ?, ?, ?)`,
+		},
+		{
+			&s.getAudit,
+			`SELECT id, chat_id, actor_id, target_id, action, params, created_at
+			FROM audit WHERE (?1=0 OR chat_id=?1) AND (?2=0 OR id<?2)
+			ORDER BY id DESC LIMIT ?3`,
+		},
+		{
+			&s.addName,
+			`INSERT INTO names VALUES(?1, ?2, ?3, ?4, ?5, ?5)
+			ON CONFLICT(chat_id, user_id, username, full_name) DO UPDATE SET
+				first_seen=min(first_seen, excluded.first_seen),
+				last_seen=max(last_seen, excluded.last_seen)`,
+		},
+		{
+			&s.getNames,
+			`SELECT username, full_name, first_seen, last_seen FROM names
+			WHERE chat_id=? AND user_id=? ORDER BY last_seen DESC`,
+		},
+		{
+			&s.findUser,
+			`SELECT user_id FROM names WHERE chat_id=? AND username=? COLLATE NOCASE
+			ORDER BY last_seen DESC LIMIT 1`,
+		},
+		{
+			&s.addMessage,
+			`INSERT OR REPLACE INTO messages VALUES(?, ?, ?, ?)`,
+		},
+		{
+			&s.getMessageAuthor,
+			`SELECT user_id FROM messages WHERE chat_id=? AND message_id=?`,
+		},
+		{
+			&s.pruneMessages,
+			`DELETE FROM messages WHERE seen_at<?`,
+		},
+		{
+			&s.getReactionMap,
+			`SELECT reaction, category FROM reaction_map WHERE chat_id=?`,
+		},
+		{
+			&s.setCategory,
+			`INSERT OR REPLACE INTO reaction_map VALUES(?, ?, ?)`,
+		},
+		{
+			&s.resetCategory,
+			`DELETE FROM reaction_map WHERE chat_id=? AND reaction=?`,
+		},
+		{
+			&s.getWeights,
+			`SELECT category, weight FROM weights WHERE chat_id=?`,
+		},
+		{
+			&s.setWeight,
+			`INSERT OR REPLACE INTO weights VALUES(?, ?, ?)`,
+		},
+		{
+			&s.resetWeight,
+			`DELETE FROM weights WHERE chat_id=? AND category=?`,
+		},
+		{
+			&s.getRateLimit,
+			`SELECT window_seconds, burst, daily, per_receiver FROM rate_limits
+			WHERE chat_id=?`,
+		},
+		{
+			&s.setRateLimit,
+			`INSERT OR REPLACE INTO rate_limits VALUES(?, ?, ?, ?, ?)`,
+		},
+		{
+			&s.resetRateLimit,
+			`DELETE FROM rate_limits WHERE chat_id=?`,
+		},
+	}
+}
+
+// prepare is a function which prepares all statements used by store
+func (s *SQLite) prepare() error {
+	for _, x := range s.statements() {
+		stmt, err := s.pool.Prepare(x.query)
+		if err != nil {
+			return err
+		}
+
+		*x.stmt = stmt
+	}
+
+	return nil
+}
+
+// TopRating is a function which returns users rating for reactions
+// received in window
+func (s *SQLite) TopRating(chatId int64, window Window) ([]models.User, error) {
+	categories, err := s.GetReactionMap(chatId)
+	if err != nil {
+		return []models.User{}, err
+	}
+
+	weights, err := s.GetWeights(chatId)
+	if err != nil {
+		return []models.User{}, err
+	}
+
+	from, to := window.bounds()
+
+	rows, err := s.topRating.Query(chatId, from, to)
+	if err != nil {
+		return []models.User{}, err
+	}
+	defer rows.Close()
+
+	usermap := map[int64]models.User{}
+
+	for rows.Next() {
+		var userId int64
+		var reaction string
+
+		err := rows.Scan(&userId, &reaction)
+		if err != nil {
+			return []models.User{}, err
+		}
+
+		tmp, exists := usermap[userId]
+		if !exists {
+			tmp = models.User{UserId: userId}
+		}
+
+		count(&tmp, categories[reaction])
+
+		usermap[userId] = tmp
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []models.User{}, err
+	}
+
+	adjustments, err := s.topAdjustments.Query(chatId, from, to)
+	if err != nil {
+		return []models.User{}, err
+	}
+	defer adjustments.Close()
+
+	for adjustments.Next() {
+		var (
+			userId   int64
+			category string
+			amount   int
+		)
+
+		err := adjustments.Scan(&userId, &category, &amount)
+		if err != nil {
+			return []models.User{}, err
+		}
+
+		tmp, exists := usermap[userId]
+		if !exists {
+			tmp = models.User{UserId: userId}
+		}
+
+		adjust(&tmp, category, amount)
+
+		usermap[userId] = tmp
+	}
+
+	err = adjustments.Err()
+	if err != nil {
+		return []models.User{}, err
+	}
+
+	for userId, user := range usermap {
+		score(&user, weights)
+		usermap[userId] = user
+	}
+
+	return maps.Values(usermap), nil
+}
+
+// GetUserRating is a function which returns rating for specific user.
+func (s *SQLite) GetUserRating(chatId, userId int64) (models.User, error) {
+	categories, err := s.GetReactionMap(chatId)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	weights, err := s.GetWeights(chatId)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	rows, err := s.userRating.Query(chatId, userId)
+	if err != nil {
+		return models.User{}, err
+	}
+	defer rows.Close()
+
+	user := models.User{UserId: userId}
+
+	for rows.Next() {
+		var reaction string
+
+		err := rows.Scan(&reaction)
+		if err != nil {
+			return models.User{}, err
+		}
+
+		count(&user, categories[reaction])
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	adjustments, err := s.userAdjustments.Query(chatId, userId)
+	if err != nil {
+		return models.User{}, err
+	}
+	defer adjustments.Close()
+
+	for adjustments.Next() {
+		var (
+			category string
+			amount   int
+		)
+
+		err := adjustments.Scan(&category, &amount)
+		if err != nil {
+			return models.User{}, err
+		}
+
+		adjust(&user, category, amount)
+	}
+
+	err = adjustments.Err()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	score(&user, weights)
+
+	return user, nil
+}
+
+// AddReaction is a function which adds reaction made at time to database
+func (s *SQLite) AddReaction(chatId, fromUserId, userId, messageId int64, reaction string, at time.Time) error {
+	// No karma for you, buddy
+	if userId == fromUserId {
+		return nil
+	}
+
+	var blacklisted bool
+
+	err := s.isBlacklisted.QueryRow(chatId, userId, fromUserId, at.Unix()).Scan(&blacklisted)
+	if err != nil {
+		return err
+	}
+
+	if blacklisted {
+		// blacklist clause
+		return nil
+	}
+
+	// Reactions already stored are not counted by rate limiter again
+	var exists bool
+
+	err = s.hasReaction.QueryRow(chatId, fromUserId, userId, messageId, reaction).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	policy, err := s.GetRateLimit(chatId)
+	if err != nil {
+		return err
+	}
+
+	dropped, err := s.limiter.drop(chatId, fromUserId, userId, policy, at)
+	if err != nil {
+		return err
+	}
+
+	if dropped {
+		return nil
+	}
+
+	_, err = s.addReaction.Exec(
+		chatId,
+		fromUserId,
+		userId,
+		messageId,
+		reaction,
+		at.Unix(),
+		at.UnixNano(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RemoveReaction is a function which removes reaction from database
+func (s *SQLite) RemoveReaction(chatId, fromUserId, messageId int64, reaction string) error {
+	_, err := s.removeReaction.Exec(chatId, fromUserId, messageId, reaction)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddBlacklist is a function which adds user into chatId blacklist,
+// expired entry of user is replaced
+func (s *SQLite) AddBlacklist(chatId int64, entry models.BlacklistEntry) error {
+	res, err := s.addBlacklist.Exec(
+		chatId,
+		entry.UserId,
+		entry.ActorId,
+		entry.Reason,
+		unixTime(entry.CreatedAt),
+		unixTime(entry.ExpiresAt),
+		time.Now().Unix(),
+		entry.Mode,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrAlreadyBlacklisted
+	}
+
+	return nil
+}
+
+// RemoveBlacklist is a function which removes user from chatId blacklist
+func (s *SQLite) RemoveBlacklist(chatId, userId int64) error {
+	res, err := s.removeBlacklist.Exec(chatId, userId, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotInBlacklist
+	}
+
+	return nil
+}
+
+// GetBlacklist is a function which returns active (not expired) chatId
+// blacklist entries
+func (s *SQLite) GetBlacklist(chatId int64) ([]models.BlacklistEntry, error) {
+	rows, err := s.getBlacklist.Query(chatId, time.Now().Unix())
+	if err != nil {
+		return []models.BlacklistEntry{}, err
+	}
+	defer rows.Close()
+
+	var entries []models.BlacklistEntry
+
+	for rows.Next() {
+		var (
+			entry                models.BlacklistEntry
+			createdAt, expiresAt int64
+		)
+
+		err := rows.Scan(
+			&entry.UserId,
+			&entry.Mode,
+			&entry.ActorId,
+			&entry.Reason,
+			&createdAt,
+			&expiresAt,
+		)
+		if err != nil {
+			return []models.BlacklistEntry{}, err
+		}
+
+		entry.CreatedAt = seenTime(createdAt)
+		entry.ExpiresAt = seenTime(expiresAt)
+
+		entries = append(entries, entry)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []models.BlacklistEntry{}, err
+	}
+
+	return entries, nil
+}
+
+// AddModerator is a function which grants user bot moderation rights
+// in chatId
+func (s *SQLite) AddModerator(chatId int64, moderator models.Moderator) error {
+	res, err := s.addModerator.Exec(
+		chatId,
+		moderator.UserId,
+		moderator.ActorId,
+		unixTime(moderator.CreatedAt),
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrAlreadyModerator
+	}
+
+	return nil
+}
+
+// RemoveModerator is a function which revokes user bot moderation
+// rights in chatId
+func (s *SQLite) RemoveModerator(chatId, userId int64) error {
+	res, err := s.removeModerator.Exec(chatId, userId)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotModerator
+	}
+
+	return nil
+}
+
+// GetModerators is a function which returns chatId bot moderators
+func (s *SQLite) GetModerators(chatId int64) ([]models.Moderator, error) {
+	rows, err := s.getModerators.Query(chatId)
+	if err != nil {
+		return []models.Moderator{}, err
+	}
+	defer rows.Close()
+
+	var moderators []models.Moderator
+
+	for rows.Next() {
+		var (
+			moderator models.Moderator
+			createdAt int64
+		)
+
+		err := rows.Scan(&moderator.UserId, &moderator.ActorId, &createdAt)
+		if err != nil {
+			return []models.Moderator{}, err
+		}
+
+		moderator.CreatedAt = seenTime(createdAt)
+
+		moderators = append(moderators, moderator)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []models.Moderator{}, err
+	}
+
+	return moderators, nil
+}
+
+// IsModerator is a function which reports whether userId is bot
+// moderator in chatId
+func (s *SQLite) IsModerator(chatId, userId int64) (bool, error) {
+	var exists bool
+
+	err := s.isModerator.QueryRow(chatId, userId).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// AddAdjustment is a function which records manual rating adjustment
+// (or reset) of user in chatId
+func (s *SQLite) AddAdjustment(chatId int64, adjustment models.Adjustment) error {
+	_, err := s.addAdjustment.Exec(
+		chatId,
+		adjustment.UserId,
+		adjustment.ActorId,
+		adjustment.Category,
+		adjustment.Amount,
+		adjustment.Reset,
+		adjustment.Reason,
+		unixTime(adjustment.CreatedAt),
+		unixNano(adjustment.CreatedAt),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetAdjustments is a function which returns up to limit latest
+// adjustments of userId in chatId (of all users if userId is zero),
+// most recent first
+func (s *SQLite) GetAdjustments(chatId, userId int64, limit int) ([]models.Adjustment, error) {
+	rows, err := s.getAdjustments.Query(chatId, userId, limit)
+	if err != nil {
+		return []models.Adjustment{}, err
+	}
+	defer rows.Close()
+
+	return scanAdjustments(rows)
+}
+
+// AddAudit is a function which appends privileged action entry into
+// audit log
+func (s *SQLite) AddAudit(entry models.AuditEntry) error {
+	params, err := encodeParams(entry.Params)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.addAudit.Exec(
+		entry.ChatId,
+		entry.ActorId,
+		entry.TargetId,
+		entry.Action,
+		params,
+		unixTime(entry.CreatedAt),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetAudit is a function which returns up to limit audit entries of
+// chatId (of all chats if chatId is zero) with id less than before (any
+// if before is zero), most recent first
+func (s *SQLite) GetAudit(chatId, before int64, limit int) ([]models.AuditEntry, error) {
+	rows, err := s.getAudit.Query(chatId, before, limit)
+	if err != nil {
+		return []models.AuditEntry{}, err
+	}
+	defer rows.Close()
+
+	return scanAudit(rows)
+}
+
+// AddAPIKey is a function which stores webserver API key scoped to its
+// chats
+func (s *SQLite) AddAPIKey(key models.APIKey) error {
+	if len(key.ChatIds) == 0 {
+		return ErrNoKeyChats
+	}
+
+	return transact(s.db, func(tx queryer) error {
+		res, err := tx.Exec(
+			`INSERT OR IGNORE INTO api_keys VALUES(?, ?, ?, ?)`,
+			key.Id,
+			key.Secret,
+			unixTime(key.CreatedAt),
+			unixTime(key.ExpiresAt),
+		)
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return ErrAPIKeyExists
+		}
+
+		for _, chatId := range key.ChatIds {
+			_, err := tx.Exec(`INSERT OR IGNORE INTO api_key_chats VALUES(?, ?)`, key.Id, chatId)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetAPIKey is a function which returns API key by id. Returns
+// ErrUnknownAPIKey if there is no such key.
+func (s *SQLite) GetAPIKey(id string) (models.APIKey, error) {
+	rows, err := s.db.Query(apiKeysQuery+` WHERE k.id=? ORDER BY c.chat_id`, id)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	defer rows.Close()
+
+	keys, err := scanAPIKeys(rows)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	if len(keys) == 0 {
+		return models.APIKey{}, ErrUnknownAPIKey
+	}
+
+	return keys[0], nil
+}
+
+// GetAPIKeys is a function which returns API keys allowed to post
+// reactions of chatId (all keys if chatId is zero)
+func (s *SQLite) GetAPIKeys(chatId int64) ([]models.APIKey, error) {
+	rows, err := s.db.Query(
+		apiKeysQuery+` WHERE ?1=0 OR k.id IN (SELECT key_id FROM api_key_chats WHERE chat_id=?1)
+		ORDER BY k.created_at, k.id, c.chat_id`,
+		chatId,
+	)
+	if err != nil {
+		return []models.APIKey{}, err
+	}
+	defer rows.Close()
+
+	return scanAPIKeys(rows)
+}
+
+// RemoveAPIKey is a function which revokes API key. Returns
+// ErrUnknownAPIKey if there is no such key.
+func (s *SQLite) RemoveAPIKey(id string) error {
+	return transact(s.db, func(tx queryer) error {
+		res, err := tx.Exec(`DELETE FROM api_keys WHERE id=?`, id)
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return ErrUnknownAPIKey
+		}
+
+		_, err = tx.Exec(`DELETE FROM api_key_chats WHERE key_id=?`, id)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// AddName is a function which records username and full name userId
+// was seen with in chatId at seen time
+func (s *SQLite) AddName(chatId, userId int64, username, fullName string, seen time.Time) error {
+	_, err := s.addName.Exec(chatId, userId, username, fullName, seen.Unix())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetNames is a function which returns names userId was seen with in
+// chatId, most recent first
+func (s *SQLite) GetNames(chatId, userId int64) ([]models.Name, error) {
+	rows, err := s.getNames.Query(chatId, userId)
+	if err != nil {
+		return []models.Name{}, err
+	}
+	defer rows.Close()
+
+	var names []models.Name
+
+	for rows.Next() {
+		name := models.Name{UserId: userId}
+
+		var firstSeen, lastSeen int64
+
+		err := rows.Scan(&name.Username, &name.FullName, &firstSeen, &lastSeen)
+		if err != nil {
+			return []models.Name{}, err
+		}
+
+		name.FirstSeen = seenTime(firstSeen)
+		name.LastSeen = seenTime(lastSeen)
+
+		names = append(names, name)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []models.Name{}, err
+	}
+
+	return names, nil
+}
+
+// GetLatestNames is a function which returns most recent names of
+// userIds in chatId with single query
+func (s *SQLite) GetLatestNames(chatId int64, userIds []int64) (map[int64]models.Name, error) {
+	names := map[int64]models.Name{}
+
+	if len(userIds) == 0 {
+		return names, nil
+	}
+
+	args := []any{chatId}
+	for _, userId := range userIds {
+		args = append(args, userId)
+	}
+
+	// Placeholders count varies, so statement can't be prepared once
+	rows, err := s.db.Query(
+		`SELECT user_id, username, full_name, first_seen, last_seen FROM names
+		WHERE chat_id=? AND user_id IN (?`+strings.Repeat(",?", len(userIds)-1)+`)
+		ORDER BY last_seen`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			name                models.Name
+			firstSeen, lastSeen int64
+		)
+
+		err := rows.Scan(&name.UserId, &name.Username, &name.FullName, &firstSeen, &lastSeen)
+		if err != nil {
+			return nil, err
+		}
+
+		name.FirstSeen = seenTime(firstSeen)
+		name.LastSeen = seenTime(lastSeen)
+
+		// Rows are ordered by time, so latest name wins
+		names[name.UserId] = name
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// GetReactions is a function which returns reactions set on messageId in chatId
+func (s *SQLite) GetReactions(chatId, messageId int64) ([]models.Reaction, error) {
+	rows, err := s.getReactions.Query(chatId, messageId)
+	if err != nil {
+		return []models.Reaction{}, err
+	}
+	defer rows.Close()
+
+	var reactions []models.Reaction
+
+	for rows.Next() {
+		var fromUserId int64
+		var reaction string
+
+		err := rows.Scan(&fromUserId, &reaction)
+		if err != nil {
+			return []models.Reaction{}, err
+		}
+
+		reactions = append(reactions, models.Reaction{
+			UserId:   fromUserId,
+			Reaction: reaction,
+		})
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []models.Reaction{}, err
+	}
+
+	return reactions, nil
+}
+
+// AddMessage is a function which remembers message author, so native
+// Telegram reaction updates (which lack author) can be attributed
+func (s *SQLite) AddMessage(chatId, messageId, userId int64, at time.Time) error {
+	_, err := s.addMessage.Exec(chatId, messageId, userId, at.Unix())
+	if err != nil {
+		return err
+	}
+
+	if s.messages.Add(1)%messagePrune != 0 {
+		return nil
+	}
+
+	_, err = s.pruneMessages.Exec(at.Add(-messageRetention).Unix())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetMessageAuthor is a function which returns author of messageId in chatId.
+// Returns ErrUnknownMessage if message was not seen before.
+func (s *SQLite) GetMessageAuthor(chatId, messageId int64) (int64, error) {
+	var userId int64
+
+	err := s.getMessageAuthor.QueryRow(chatId, messageId).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrUnknownMessage
+		}
+
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+// GetReactionMap is a function which returns reaction -> category map
+// used in chatId (registry defaults with chat overrides)
+func (s *SQLite) GetReactionMap(chatId int64) (map[string]string, error) {
+	rows, err := s.getReactionMap.Query(chatId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := map[string]string{}
+
+	for rows.Next() {
+		var reaction, category string
+
+		err := rows.Scan(&reaction, &category)
+		if err != nil {
+			return nil, err
+		}
+
+		overrides[reaction] = category
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.registry.Merge(overrides), nil
+}
+
+// SetReactionCategory is a function which overrides reaction category
+// in chatId
+func (s *SQLite) SetReactionCategory(chatId int64, reaction, category string) error {
+	_, err := s.setCategory.Exec(chatId, reaction, category)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ResetReactionCategory is a function which drops chatId override of
+// reaction category
+func (s *SQLite) ResetReactionCategory(chatId int64, reaction string) error {
+	_, err := s.resetCategory.Exec(chatId, reaction)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetWeights is a function which returns category -> score weight map
+// used in chatId (defaults with chat overrides)
+func (s *SQLite) GetWeights(chatId int64) (map[string]float64, error) {
+	rows, err := s.getWeights.Query(chatId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := map[string]float64{}
+
+	for rows.Next() {
+		var category string
+		var weight float64
+
+		err := rows.Scan(&category, &weight)
+		if err != nil {
+			return nil, err
+		}
+
+		overrides[category] = weight
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeWeights(overrides), nil
+}
+
+// SetWeight is a function which overrides category score weight in chatId
+func (s *SQLite) SetWeight(chatId int64, category string, weight float64) error {
+	_, err := s.setWeight.Exec(chatId, category, weight)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ResetWeight is a function which drops chatId override of category
+// score weight
+func (s *SQLite) ResetWeight(chatId int64, category string) error {
+	_, err := s.resetWeight.Exec(chatId, category)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetRateLimit is a function which returns reactions rate limit policy
+// used in chatId, DefaultRateLimit unless chat overrides it
+func (s *SQLite) GetRateLimit(chatId int64) (RateLimit, error) {
+	var window int64
+
+	policy := RateLimit{}
+
+	err := s.getRateLimit.QueryRow(chatId).Scan(
+		&window,
+		&policy.Burst,
+		&policy.Daily,
+		&policy.PerReceiver,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return DefaultRateLimit, nil
+		}
+
+		return RateLimit{}, err
+	}
+
+	policy.Window = time.Duration(window) * time.Second
+
+	return policy, nil
+}
+
+// SetRateLimit is a function which overrides reactions rate limit
+// policy in chatId
+func (s *SQLite) SetRateLimit(chatId int64, policy RateLimit) error {
+	_, err := s.setRateLimit.Exec(
+		chatId,
+		int64(policy.Window/time.Second),
+		policy.Burst,
+		policy.Daily,
+		policy.PerReceiver,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ResetRateLimit is a function which drops chatId override of
+// reactions rate limit policy
+func (s *SQLite) ResetRateLimit(chatId int64) error {
+	_, err := s.resetRateLimit.Exec(chatId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FindUser is a function which returns id of user last seen with
+// username in chatId. Returns ErrUnknownUser if there is no such user.
+func (s *SQLite) FindUser(chatId int64, username string) (int64, error) {
+	var userId int64
+
+	err := s.findUser.QueryRow(chatId, username).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrUnknownUser
+		}
+
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+// Close is a function which closes prepared statements and database
+func (s *SQLite) Close() error {
+	statements := []*sql.Stmt{
+		s.topRating,
+		s.userRating,
+		s.topAdjustments,
+		s.userAdjustments,
+		s.isBlacklisted,
+		s.hasReaction,
+		s.addReaction,
+		s.removeReaction,
+		s.getReactions,
+		s.addBlacklist,
+		s.removeBlacklist,
+		s.getBlacklist,
+		s.addModerator,
+		s.removeModerator,
+		s.getModerators,
+		s.isModerator,
+		s.addAdjustment,
+		s.getAdjustments,
+		s.addAudit,
+		s.getAudit,
+		s.addName,
+		s.getNames,
+		s.findUser,
+		s.addMessage,
+		s.getMessageAuthor,
+		s.pruneMessages,
+		s.getReactionMap,
+		s.setCategory,
+		s.resetCategory,
+		s.getWeights,
+		s.setWeight,
+		s.resetWeight,
+		s.getRateLimit,
+		s.setRateLimit,
+		s.resetRateLimit,
+	}
+
+	for _, stmt := range statements {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+
+	if s.cooldowns != nil {
+		s.cooldowns.Close()
+	}
+
+	return s.pool.Close()
+}
+
+// Batch is a function which runs items in single transaction
+func (s *SQLite) Batch(items []BatchItem, opts BatchOpts) ([]error, error) {
+	return batchItems(s, items, opts)
+}
+
+// BatchStream is a function which runs items next returns in single
+// transaction. Its reactions share rate limit with reactions outside of
+// batch, which wait until it ends (unless batch has cooldowns of its
+// own or none).
+func (s *SQLite) BatchStream(next func() BatchItem, report func(err error), opts BatchOpts) error {
+	// Limiter is locked before transaction begins, as reactions
+	// outside of batch lock it first too
+	if !opts.NoCooldowns && opts.Cooldowns == nil {
+		s.limiter.mux.Lock()
+		defer s.limiter.mux.Unlock()
+	}
+
+	tx, err := s.pool.Begin()
+	if err != nil {
+		return err
+	}
+
+	bound := *s
+	bound.db = tx
+	bound.cooldowns = s.cooldowns.bind(tx)
+	bound.limiter = NewLimiter(bound.cooldowns)
+
+	switch {
+	case opts.NoCooldowns:
+		bound.limiter = nil
+	case opts.Cooldowns != nil:
+		bound.limiter = NewLimiter(opts.Cooldowns)
+	}
+
+	for _, x := range bound.statements() {
+		*x.stmt = tx.Stmt(*x.stmt)
+	}
+
+	return runBatch(tx, &bound, next, report, opts)
+}
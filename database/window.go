@@ -0,0 +1,37 @@
+package database
+
+import (
+	"math"
+	"time"
+)
+
+// Window is a time window reactions are counted in,
+// zero From or To means window is not bounded from that side
+type Window struct {
+	From time.Time
+	To   time.Time
+}
+
+// AllTime is a window without bounds
+var AllTime = Window{}
+
+// bounds is a function which returns window as [from, to) unix seconds
+func (w Window) bounds() (int64, int64) {
+	var from, to int64 = 0, math.MaxInt64
+
+	if !w.From.IsZero() {
+		from = w.From.Unix()
+	}
+
+	if !w.To.IsZero() {
+		to = w.To.Unix()
+	}
+
+	return from, to
+}
+
+// contains is a function which reports whether unix time is in window
+func (w Window) contains(unix int64) bool {
+	from, to := w.bounds()
+	return unix >= from && unix < to
+}
@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/xbt573/flood-social-rep/database"
+	"github.com/xbt573/flood-social-rep/models"
+	"golang.org/x/exp/slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// adjustUsage is a reply to malformed /repadjust
+const adjustUsage = "Использование: /repadjust <юзер> <категория> <+/-n> [причина]"
+
+// adjustmentsLimit is a number of adjustments /repadjust lists
+const adjustmentsLimit = 20
+
+// resetPrefix is a prefix of rating reset confirmation callback data
+const resetPrefix = "reset|"
+
+// resetTimeout is a time rating reset can be confirmed in
+const resetTimeout = 5 * time.Minute
+
+// Adjustment handler, adds n to user category count:
+// /repadjust <user> <category> <+/-n> [reason]. Without category it
+// lists latest adjustments of user, or of whole chat without user.
+func (h handler) repadjust(bot *gotgbot.Bot, ctx *ext.Context) error {
+	if !hasTarget(ctx) {
+		return h.adjustmentList(bot, ctx, 0)
+	}
+
+	target, args, err := h.resolveTarget(bot, ctx)
+	if err != nil {
+		return replyTargetError(bot, ctx, err)
+	}
+
+	if len(args) == 0 {
+		return h.adjustmentList(bot, ctx, target.UserId)
+	}
+
+	allowed, err := h.authorize(bot, ctx, moderate)
+	if err != nil || !allowed {
+		return err
+	}
+
+	adjustment, ok := parseAdjustment(args)
+	if !ok {
+		_, err := ctx.EffectiveMessage.Reply(bot, adjustUsage, nil)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	// Adjustment of category chat doesn't show would never be seen
+	reactionMap, err := h.store.GetReactionMap(ctx.EffectiveChat.Id)
+	if err != nil {
+		return err
+	}
+
+	categories := chatCategories(reactionMap, database.CategoryLike)
+	if !slices.Contains(categories, adjustment.Category) {
+		_, err := ctx.EffectiveMessage.Reply(
+			bot,
+			"Неизвестная категория, доступны: "+strings.Join(categories, ", "),
+			nil,
+		)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	adjustment.UserId = target.UserId
+	adjustment.ActorId = actorId(ctx)
+	adjustment.CreatedAt = time.Now()
+
+	err = h.audit(ctx, database.AuditAdjust, adjustment.UserId, map[string]string{
+		"category": adjustment.Category,
+		"amount":   fmt.Sprintf("%+d", adjustment.Amount),
+		"reason":   adjustment.Reason,
+	}, func(store database.Store) error {
+		return store.AddAdjustment(ctx.EffectiveChat.Id, adjustment)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, "Готово", nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// parseAdjustment is a function which parses <category> <+/-n> [reason]
+// arguments, false if they are malformed
+func parseAdjustment(args []string) (models.Adjustment, bool) {
+	if len(args) < 2 {
+		return models.Adjustment{}, false
+	}
+
+	category := strings.ToLower(args[0])
+	if category == database.CategoryNone {
+		return models.Adjustment{}, false
+	}
+
+	amount, err := strconv.Atoi(args[1])
+	if err != nil || amount == 0 {
+		return models.Adjustment{}, false
+	}
+
+	return models.Adjustment{
+		Category: category,
+		Amount:   amount,
+		Reason:   strings.Join(args[2:], " "),
+	}, true
+}
+
+// adjustmentList is a function which replies with latest adjustments
+// of userId (of whole chat if userId is zero)
+func (h handler) adjustmentList(bot *gotgbot.Bot, ctx *ext.Context, userId int64) error {
+	chatId := ctx.EffectiveChat.Id
+
+	adjustments, err := h.store.GetAdjustments(chatId, userId, adjustmentsLimit)
+	if err != nil {
+		return err
+	}
+
+	if len(adjustments) == 0 {
+		_, err := ctx.EffectiveMessage.Reply(bot, "Корректировок нет", nil)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	var userIds []int64
+	for _, adjustment := range adjustments {
+		userIds = append(userIds, adjustment.UserId)
+
+		if adjustment.ActorId != 0 {
+			userIds = append(userIds, adjustment.ActorId)
+		}
+	}
+
+	h.names.Warm(bot, chatId, userIds)
+
+	message := "Корректировки:"
+
+	for _, adjustment := range adjustments {
+		change := "обнуление"
+		if !adjustment.Reset {
+			change = fmt.Sprintf("%v %+d", adjustment.Category, adjustment.Amount)
+		}
+
+		message += fmt.Sprintf(
+			"\n%v %v: %v",
+			formatSeen(adjustment.CreatedAt),
+			h.names.Name(chatId, adjustment.UserId),
+			change,
+		)
+
+		if adjustment.ActorId != 0 {
+			message += fmt.Sprintf(", от %v", h.names.Name(chatId, adjustment.ActorId))
+		}
+
+		if adjustment.Reason != "" {
+			message += fmt.Sprintf(" (%v)", adjustment.Reason)
+		}
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, message, nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Reset handler, asks to confirm zeroing user rating: /represet <user>
+func (h handler) represet(bot *gotgbot.Bot, ctx *ext.Context) error {
+	allowed, err := h.authorize(bot, ctx, moderate)
+	if err != nil || !allowed {
+		return err
+	}
+
+	target, _, err := h.resolveTarget(bot, ctx)
+	if err != nil {
+		return replyTargetError(bot, ctx, err)
+	}
+
+	confirm := fmt.Sprintf("%v%v|%v", resetPrefix, target.UserId, time.Now().Unix())
+	h.resets.add(ctx.EffectiveChat.Id, confirm)
+
+	_, err = ctx.EffectiveMessage.Reply(
+		bot,
+		fmt.Sprintf("Обнулить рейтинг %v? Полученные реакции и корректировки перестанут учитываться", target.Name),
+		&gotgbot.SendMessageOpts{
+			ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+				InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{
+					{Text: "Обнулить", CallbackData: confirm},
+					{Text: "Отмена", CallbackData: resetPrefix + "-"},
+				}},
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// resetCallback is a function which handles rating reset confirmation
+// buttons, only users allowed to reset can press them
+func (h handler) resetCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
+	cq := ctx.CallbackQuery
+
+	if cq.Message == nil {
+		_, err := cq.Answer(bot, nil)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	reason, err := h.check(bot, ctx, moderate)
+	if err != nil {
+		return err
+	}
+
+	if reason != "" {
+		_, err := cq.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: reason, ShowAlert: true})
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	chatId := cq.Message.GetChat().Id
+
+	var text string
+
+	userId, askedAt, ok := parseReset(cq.Data)
+
+	// Confirmation is taken before reset, so pressing it twice doesn't
+	// reset twice
+	if ok && !h.resets.take(chatId, cq.Data) {
+		_, err := cq.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{
+			Text:      "Подтверждение уже использовано или устарело",
+			ShowAlert: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	switch {
+	case !ok:
+		text = "Отменено"
+	case time.Since(time.Unix(askedAt, 0)) > resetTimeout:
+		text = "Время подтверждения вышло"
+	default:
+		err := h.audit(ctx, database.AuditReset, userId, nil, func(store database.Store) error {
+			return store.AddAdjustment(chatId, models.Adjustment{
+				UserId:    userId,
+				ActorId:   actorId(ctx),
+				Reset:     true,
+				CreatedAt: time.Now(),
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		h.names.Warm(bot, chatId, []int64{userId})
+		text = fmt.Sprintf("Рейтинг %v обнулён", h.names.Name(chatId, userId))
+	}
+
+	_, err = cq.Answer(bot, nil)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = bot.EditMessageText(text, &gotgbot.EditMessageTextOpts{
+		ChatId:    chatId,
+		MessageId: cq.Message.GetMessageId(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// parseReset is a function which parses reset confirmation callback
+// data into user id and time reset was asked at, false if it's cancel
+func parseReset(data string) (int64, int64, bool) {
+	parts := strings.Split(strings.TrimPrefix(data, resetPrefix), "|")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	userId, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	askedAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return userId, askedAt, true
+}
+
+// pendingResets are rating resets waiting for confirmation, every
+// confirmation is taken once
+type pendingResets struct {
+	// confirmations are chat id and callback data -> time reset was
+	// asked at
+	confirmations map[string]time.Time
+
+	// mux is sync.Mutex which is locked where confirmations are accessed
+	mux sync.Mutex
+}
+
+// newPendingResets is a function which creates empty pendingResets
+func newPendingResets() *pendingResets {
+	return &pendingResets{confirmations: map[string]time.Time{}}
+}
+
+// add is a function which registers confirmation of reset asked in
+// chatId, timed out confirmations are dropped
+func (p *pendingResets) add(chatId int64, data string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	now := time.Now()
+
+	for key, askedAt := range p.confirmations {
+		if now.Sub(askedAt) > resetTimeout {
+			delete(p.confirmations, key)
+		}
+	}
+
+	p.confirmations[fmt.Sprintf("%v|%v", chatId, data)] = now
+}
+
+// take is a function which removes confirmation of reset in chatId,
+// false if it was already taken or never added
+func (p *pendingResets) take(chatId int64, data string) bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	key := fmt.Sprintf("%v|%v", chatId, data)
+
+	_, exists := p.confirmations[key]
+	delete(p.confirmations, key)
+
+	return exists
+}
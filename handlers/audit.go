@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/xbt573/flood-social-rep/database"
+	"github.com/xbt573/flood-social-rep/models"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Audit log limits of /auditlog
+const (
+	auditDefault = 10
+	auditMax     = 50
+)
+
+// auditLayout is a layout of audit entry time
+const auditLayout = "02.01.2006 15:04"
+
+// auditActions are descriptions of audit actions
+var auditActions = map[string]string{
+	database.AuditIgnore:      "игнор",
+	database.AuditUnignore:    "снятие игнора",
+	database.AuditModerator:   "назначение модератора",
+	database.AuditUnmoderator: "снятие модератора",
+	database.AuditAdjust:      "корректировка",
+	database.AuditReset:       "обнуление",
+	database.AuditReactionMap: "категория реакции",
+	database.AuditWeight:      "вес категории",
+	database.AuditRateLimit:   "лимит реакций",
+	database.AuditAPIKey:      "выдача API ключа",
+	database.AuditUnAPIKey:    "отзыв API ключа",
+}
+
+// audit is a function which runs change of privileged action of command
+// sender aimed at targetId (zero if none) and records action into audit
+// log in the same transaction, so neither is kept without the other.
+// Error of change is returned as is.
+func (h handler) audit(
+	ctx *ext.Context,
+	action string,
+	targetId int64,
+	params map[string]string,
+	change func(store database.Store) error,
+) error {
+	entry := models.AuditEntry{
+		ChatId:    ctx.EffectiveChat.Id,
+		ActorId:   actorId(ctx),
+		TargetId:  targetId,
+		Action:    action,
+		Params:    params,
+		CreatedAt: time.Now(),
+	}
+
+	errs, err := h.store.Batch([]database.BatchItem{func(store database.Store) error {
+		err := change(store)
+		if err != nil {
+			return err
+		}
+
+		return store.AddAudit(entry)
+	}}, database.BatchOpts{Atomic: true})
+	if len(errs) > 0 && errs[0] != nil {
+		return errs[0]
+	}
+
+	return err
+}
+
+// Audit log handler, shows latest n privileged actions in chat:
+// /auditlog [n]
+func (h handler) auditlog(bot *gotgbot.Bot, ctx *ext.Context) error {
+	allowed, err := h.authorize(bot, ctx, configure)
+	if err != nil || !allowed {
+		return err
+	}
+
+	limit := auditDefault
+
+	args := ctx.Args()[1:]
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			_, err := ctx.EffectiveMessage.Reply(bot, "Использование: /auditlog [количество]", nil)
+			if err != nil {
+				return err
+			}
+
+			return nil
+		}
+
+		limit = n
+		if limit > auditMax {
+			limit = auditMax
+		}
+	}
+
+	chatId := ctx.EffectiveChat.Id
+
+	entries, err := h.store.GetAudit(chatId, 0, limit)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		_, err := ctx.EffectiveMessage.Reply(bot, "Журнал пуст", nil)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	var userIds []int64
+	for _, entry := range entries {
+		for _, userId := range []int64{entry.ActorId, entry.TargetId} {
+			if userId != 0 {
+				userIds = append(userIds, userId)
+			}
+		}
+	}
+
+	h.names.Warm(bot, chatId, userIds)
+
+	message := "Журнал:"
+
+	for _, entry := range entries {
+		actor := "анонимный админ"
+		if entry.ActorId != 0 {
+			actor = h.names.Name(chatId, entry.ActorId)
+		}
+
+		action, exists := auditActions[entry.Action]
+		if !exists {
+			action = entry.Action
+		}
+
+		message += fmt.Sprintf("\n%v %v: %v", entry.CreatedAt.Format(auditLayout), actor, action)
+
+		if entry.TargetId != 0 {
+			message += " → " + h.names.Name(chatId, entry.TargetId)
+		}
+
+		message += formatParams(entry.Params)
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, message, nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// formatParams returns audit entry params as " (key=value, ...)"
+// sorted by key, empty string if there are none
+func formatParams(params map[string]string) string {
+	var keys []string
+	for key, value := range params {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return ""
+	}
+
+	sort.Strings(keys)
+
+	formatted := " ("
+	for i, key := range keys {
+		if i > 0 {
+			formatted += ", "
+		}
+
+		formatted += fmt.Sprintf("%v=%v", key, params[key])
+	}
+
+	return formatted + ")"
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/xbt573/flood-social-rep/database"
+	"github.com/xbt573/flood-social-rep/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// blacklistModes are descriptions of blacklist modes
+var blacklistModes = map[string]string{
+	database.BlacklistReceive: "не получает",
+	database.BlacklistGive:    "не даёт",
+	database.BlacklistBoth:    "не получает и не даёт",
+}
+
+// parseIgnoreArgs fills entry mode, expiry and reason from
+// [mode] [duration] [reason] arguments, mode is receive by default
+func parseIgnoreArgs(args []string, entry *models.BlacklistEntry) {
+	entry.Mode = database.BlacklistReceive
+
+	if len(args) > 0 {
+		mode := strings.ToLower(args[0])
+		if _, exists := blacklistModes[mode]; exists {
+			entry.Mode = mode
+			args = args[1:]
+		}
+	}
+
+	if len(args) > 0 {
+		if duration, ok := parseDuration(args[0]); ok {
+			entry.ExpiresAt = entry.CreatedAt.Add(duration)
+			args = args[1:]
+		}
+	}
+
+	entry.Reason = strings.Join(args, " ")
+}
+
+// durationUnits are units of durations accepted in addition to ones
+// time.ParseDuration knows
+var durationUnits = map[string]time.Duration{
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// parseDuration parses positive duration like 30m, 12h, 7d or 2w,
+// returns false if argument is not a duration
+func parseDuration(arg string) (time.Duration, bool) {
+	for suffix, unit := range durationUnits {
+		count, err := strconv.Atoi(strings.TrimSuffix(arg, suffix))
+		if strings.HasSuffix(arg, suffix) && err == nil && count > 0 {
+			return time.Duration(count) * unit, true
+		}
+	}
+
+	duration, err := time.ParseDuration(arg)
+	if err != nil || duration <= 0 {
+		return 0, false
+	}
+
+	return duration, true
+}
+
+// formatRemaining returns duration rounded up to minutes as "2д 3ч 5м"
+func formatRemaining(duration time.Duration) string {
+	minutes := int64((duration + time.Minute - 1) / time.Minute)
+
+	days, hours := minutes/(24*60), minutes/60%24
+	minutes %= 60
+
+	var parts []string
+
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%vд", days))
+	}
+
+	if hours > 0 {
+		parts = append(parts, fmt.Sprintf("%vч", hours))
+	}
+
+	if minutes > 0 || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("%vм", minutes))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Ignore list handler, shows active chat blacklist entries
+func (h handler) ignorelist(bot *gotgbot.Bot, ctx *ext.Context) error {
+	entries, err := h.store.GetBlacklist(ctx.EffectiveChat.Id)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		_, err := ctx.EffectiveMessage.Reply(bot, "Игнор пуст", nil)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	var userIds []int64
+	for _, entry := range entries {
+		userIds = append(userIds, entry.UserId)
+
+		if entry.ActorId != 0 {
+			userIds = append(userIds, entry.ActorId)
+		}
+	}
+
+	h.names.Warm(bot, ctx.EffectiveChat.Id, userIds)
+
+	message := "Игнор:"
+	now := time.Now()
+
+	for _, entry := range entries {
+		remaining := "навсегда"
+		if !entry.ExpiresAt.IsZero() {
+			remaining = "ещё " + formatRemaining(entry.ExpiresAt.Sub(now))
+		}
+
+		message += fmt.Sprintf(
+			"\n%v: %v, %v",
+			h.names.Name(ctx.EffectiveChat.Id, entry.UserId),
+			blacklistModes[entry.Mode],
+			remaining,
+		)
+
+		if entry.ActorId != 0 {
+			message += fmt.Sprintf(", от %v", h.names.Name(ctx.EffectiveChat.Id, entry.ActorId))
+		}
+
+		if entry.Reason != "" {
+			message += fmt.Sprintf(" (%v)", entry.Reason)
+		}
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, message, nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
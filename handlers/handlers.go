@@ -7,51 +7,102 @@ import (
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/callbackquery"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/reaction"
 	"github.com/xbt573/flood-social-rep/database"
-	"sort"
+	"github.com/xbt573/flood-social-rep/models"
+	"github.com/xbt573/flood-social-rep/names"
 	"strconv"
+	"time"
 )
 
+// nameTTL is a time display names are cached for
+const nameTTL = time.Hour
+
+// handler is a set of bot handlers sharing rating store
+type handler struct {
+	store  database.Store
+	names  *names.Resolver
+	resets *pendingResets
+}
+
 // Handle is a function which adds handlers to dispatcher.
-func Handle(dispatcher *ext.Dispatcher) {
+func Handle(dispatcher *ext.Dispatcher, store database.Store) {
+	h := handler{
+		store:  store,
+		names:  names.New(store, nameTTL),
+		resets: newPendingResets(),
+	}
+
 	// Rating-related commands
-	dispatcher.AddHandler(handlers.NewCommand("liketop", liketop))
-	dispatcher.AddHandler(handlers.NewCommand("disliketop", disliketop))
-	dispatcher.AddHandler(handlers.NewCommand("whaletop", whaletop))
-	dispatcher.AddHandler(handlers.NewCommand("repignore", repignore))
-	dispatcher.AddHandler(handlers.NewCommand("repunignore", repunignore))
-	dispatcher.AddHandler(handlers.NewCommand("rep", rep))
-	dispatcher.AddHandler(handlers.NewCommand("reactions", reactions))
+	dispatcher.AddHandler(handlers.NewCommand("liketop", h.liketop))
+	dispatcher.AddHandler(handlers.NewCommand("disliketop", h.disliketop))
+	dispatcher.AddHandler(handlers.NewCommand("whaletop", h.whaletop))
+	dispatcher.AddHandler(handlers.NewCommand("top", h.top))
+	dispatcher.AddHandler(handlers.NewCommand("repignore", h.repignore))
+	dispatcher.AddHandler(handlers.NewCommand("repunignore", h.repunignore))
+	dispatcher.AddHandler(handlers.NewCommand("ignorelist", h.ignorelist))
+	dispatcher.AddHandler(handlers.NewCommand("rep", h.rep))
+	dispatcher.AddHandler(handlers.NewCommand("reactions", h.reactions))
+	dispatcher.AddHandler(handlers.NewCommand("reactionmap", h.reactionmap))
+	dispatcher.AddHandler(handlers.NewCommand("repweight", h.repweight))
+	dispatcher.AddHandler(handlers.NewCommand("names", h.nameHistory))
+	dispatcher.AddHandler(handlers.NewCommand("replimit", h.replimit))
+	dispatcher.AddHandler(handlers.NewCommand("repmod", h.repmod))
+	dispatcher.AddHandler(handlers.NewCommand("repunmod", h.repunmod))
+	dispatcher.AddHandler(handlers.NewCommand("repadjust", h.repadjust))
+	dispatcher.AddHandler(handlers.NewCommand("represet", h.represet))
+	dispatcher.AddHandler(handlers.NewCommand("auditlog", h.auditlog))
+
+	// Native reaction updates
+	dispatcher.AddHandler(handlers.NewReaction(reaction.All, h.messageReaction))
+	dispatcher.AddHandler(reactionCountHandler{response: h.messageReactionCount})
+
+	// Leaderboard inline keyboard
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(topPrefix), h.topCallback))
+
+	// Rating reset confirmation
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(resetPrefix), h.resetCallback))
+
+	// Message authors tracking, runs before commands in separate group
+	dispatcher.AddHandlerToGroup(handlers.NewMessage(message.All, h.track), -1)
 }
 
-func repignore(bot *gotgbot.Bot, ctx *ext.Context) error {
-	member, err := bot.GetChatMember(ctx.EffectiveChat.Id, ctx.EffectiveUser.Id, nil)
-	if err != nil {
+// Ignore handler, makes user (replied message author, @username, id or
+// text mention) unable to get or give rating:
+// /repignore [user] [receive|give|both] [duration] [reason]
+func (h handler) repignore(bot *gotgbot.Bot, ctx *ext.Context) error {
+	allowed, err := h.authorize(bot, ctx, moderate)
+	if err != nil || !allowed {
 		return err
 	}
 
-	if member.GetStatus() == "member" {
-		_, err := ctx.EffectiveMessage.Reply(bot, "у тебя нет прав ALO🔉🔉🔉", nil)
-		if err != nil {
-			return err
-		}
+	target, args, err := h.resolveTarget(bot, ctx)
+	if err != nil {
+		return replyTargetError(bot, ctx, err)
+	}
 
-		return nil
+	entry := models.BlacklistEntry{
+		UserId:    target.UserId,
+		ActorId:   actorId(ctx),
+		CreatedAt: time.Now(),
 	}
 
-	if ctx.EffectiveMessage.ReplyToMessage == nil {
-		_, err := ctx.EffectiveMessage.Reply(bot, "Команда должна быть ответом", nil)
-		if err != nil {
-			return err
-		}
+	parseIgnoreArgs(args, &entry)
 
-		return nil
+	expires := ""
+	if !entry.ExpiresAt.IsZero() {
+		expires = entry.ExpiresAt.Format(time.RFC3339)
 	}
 
-	err = database.AddBlacklist(
-		ctx.EffectiveChat.Id,
-		ctx.EffectiveMessage.ReplyToMessage.From.Id,
-	)
+	err = h.audit(ctx, database.AuditIgnore, entry.UserId, map[string]string{
+		"mode":    entry.Mode,
+		"expires": expires,
+		"reason":  entry.Reason,
+	}, func(store database.Store) error {
+		return store.AddBlacklist(ctx.EffectiveChat.Id, entry)
+	})
 	if err != nil {
 		if !errors.Is(err, database.ErrAlreadyBlacklisted) {
 			return err
@@ -61,39 +112,29 @@ func repignore(bot *gotgbot.Bot, ctx *ext.Context) error {
 		if err != nil {
 			return err
 		}
+
+		return nil
 	}
 
 	return nil
 }
 
-func repunignore(bot *gotgbot.Bot, ctx *ext.Context) error {
-	member, err := bot.GetChatMember(ctx.EffectiveChat.Id, ctx.EffectiveUser.Id, nil)
-	if err != nil {
+// Unignore handler, lets user (replied message author, @username, id or
+// text mention) get and give rating again: /repunignore [user]
+func (h handler) repunignore(bot *gotgbot.Bot, ctx *ext.Context) error {
+	allowed, err := h.authorize(bot, ctx, moderate)
+	if err != nil || !allowed {
 		return err
 	}
 
-	if member.GetStatus() == "member" {
-		_, err := ctx.EffectiveMessage.Reply(bot, "у тебя нет прав ALO🔉🔉🔉", nil)
-		if err != nil {
-			return err
-		}
-
-		return nil
-	}
-
-	if ctx.EffectiveMessage.ReplyToMessage == nil {
-		_, err := ctx.EffectiveMessage.Reply(bot, "Команда должна быть ответом", nil)
-		if err != nil {
-			return err
-		}
-
-		return nil
+	target, _, err := h.resolveTarget(bot, ctx)
+	if err != nil {
+		return replyTargetError(bot, ctx, err)
 	}
 
-	err = database.RemoveBlacklist(
-		ctx.EffectiveChat.Id,
-		ctx.EffectiveMessage.ReplyToMessage.From.Id,
-	)
+	err = h.audit(ctx, database.AuditUnignore, target.UserId, nil, func(store database.Store) error {
+		return store.RemoveBlacklist(ctx.EffectiveChat.Id, target.UserId)
+	})
 	if err != nil {
 		if !errors.Is(err, database.ErrNotInBlacklist) {
 			return err
@@ -103,244 +144,43 @@ func repunignore(bot *gotgbot.Bot, ctx *ext.Context) error {
 		if err != nil {
 			return err
 		}
-	}
 
-	return nil
-}
-
-// Like top handler
-func liketop(bot *gotgbot.Bot, ctx *ext.Context) error {
-	top, err := database.TopRating(ctx.EffectiveChat.Id)
-	if err != nil {
-		return err
-	}
-
-	sort.SliceStable(top, func(i, j int) bool {
-		return top[i].Likes > top[j].Likes
-	})
-
-	if len(top) >= 10 {
-		top = top[:9]
-	}
-
-	topStr := "Топ рейтинга:"
-
-	for _, topPlace := range top {
-		if topPlace.Likes == 0 {
-			continue
-		}
-
-		var username string
-
-		member, err := bot.GetChatMember(ctx.EffectiveChat.Id, topPlace.UserId, nil)
-		if err != nil {
-			name, err := database.GetUsername(topPlace.UserId)
-			if err != nil {
-				continue
-			}
-
-			username = name
-		} else {
-			username = member.GetUser().Username
-			if username == "" {
-				username = member.GetUser().FirstName
-				if member.GetUser().LastName != "" {
-					username = fmt.Sprintf(
-						"%v %v",
-						member.GetUser().FirstName,
-						member.GetUser().LastName,
-					)
-				}
-			}
-		}
-
-		topStr += fmt.Sprintf(
-			"\n%v: %v 👍 %v 👎 %v 🐳",
-			username,
-			topPlace.Likes,
-			topPlace.Dislikes,
-			topPlace.Whales,
-		)
-	}
-
-	_, err = ctx.EffectiveMessage.Reply(bot, topStr, nil)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Dislike top handler
-func disliketop(bot *gotgbot.Bot, ctx *ext.Context) error {
-	top, err := database.TopRating(ctx.EffectiveChat.Id)
-	if err != nil {
-		return err
-	}
-
-	sort.SliceStable(top, func(i, j int) bool {
-		return top[i].Dislikes > top[j].Dislikes
-	})
-
-	if len(top) >= 10 {
-		top = top[:9]
-	}
-
-	topStr := "Топ рейтинга (наоборот):"
-
-	for _, topPlace := range top {
-		if topPlace.Dislikes == 0 {
-			continue
-		}
-
-		var username string
-
-		member, err := bot.GetChatMember(ctx.EffectiveChat.Id, topPlace.UserId, nil)
-		if err != nil {
-			name, err := database.GetUsername(topPlace.UserId)
-			if err != nil {
-				continue
-			}
-
-			username = name
-		} else {
-			username = member.GetUser().Username
-			if username == "" {
-				username = member.GetUser().FirstName
-				if member.GetUser().LastName != "" {
-					username = fmt.Sprintf(
-						"%v %v",
-						member.GetUser().FirstName,
-						member.GetUser().LastName,
-					)
-				}
-			}
-		}
-
-		topStr += fmt.Sprintf(
-			"\n%v: %v 👎 %v 👍 %v 🐳",
-			username,
-			topPlace.Dislikes,
-			topPlace.Likes,
-			topPlace.Whales,
-		)
-	}
-
-	_, err = ctx.EffectiveMessage.Reply(bot, topStr, nil)
-	if err != nil {
-		return err
+		return nil
 	}
 
 	return nil
 }
 
-// Whale reputation top handler
-func whaletop(bot *gotgbot.Bot, ctx *ext.Context) error {
-	top, err := database.TopRating(ctx.EffectiveChat.Id)
-	if err != nil {
-		return err
-	}
-
-	sort.SliceStable(top, func(i, j int) bool {
-		return top[i].Whales > top[j].Whales
-	})
-
-	if len(top) >= 10 {
-		top = top[:9]
-	}
-
-	topStr := "Топ рейтинга по китам:"
-
-	for _, topPlace := range top {
-		if topPlace.Whales == 0 {
-			continue
-		}
-
-		var username string
+// Reputation handler, shows rating of sender or of user (replied
+// message author, @username, id or text mention): /rep [user]
+func (h handler) rep(bot *gotgbot.Bot, ctx *ext.Context) error {
+	userId := ctx.EffectiveMessage.From.Id
+	username := names.Display(*ctx.EffectiveMessage.From)
 
-		member, err := bot.GetChatMember(ctx.EffectiveChat.Id, topPlace.UserId, nil)
+	if hasTarget(ctx) {
+		target, _, err := h.resolveTarget(bot, ctx)
 		if err != nil {
-			name, err := database.GetUsername(topPlace.UserId)
-			if err != nil {
-				continue
-			}
-
-			username = name
-		} else {
-			username = member.GetUser().Username
-			if username == "" {
-				username = member.GetUser().FirstName
-				if member.GetUser().LastName != "" {
-					username = fmt.Sprintf(
-						"%v %v",
-						member.GetUser().FirstName,
-						member.GetUser().LastName,
-					)
-				}
-			}
+			return replyTargetError(bot, ctx, err)
 		}
 
-		topStr += fmt.Sprintf(
-			"\n%v: %v 🐳 %v 👍 %v 👎",
-			username,
-			topPlace.Whales,
-			topPlace.Likes,
-			topPlace.Dislikes,
-		)
+		userId = target.UserId
+		username = target.Name
 	}
 
-	_, err = ctx.EffectiveMessage.Reply(bot, topStr, nil)
+	categories, err := h.store.GetReactionMap(ctx.EffectiveChat.Id)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// Reputation handler
-func rep(bot *gotgbot.Bot, ctx *ext.Context) error {
-	userId := ctx.EffectiveMessage.From.Id
-	username := ctx.EffectiveMessage.From.Username
-
-	// If username is doesn't exist - create it from first and last name
-	if username == "" {
-		username = ctx.EffectiveMessage.From.FirstName
-		if ctx.EffectiveMessage.From.LastName != "" {
-			username = fmt.Sprintf(
-				"%v %v",
-				ctx.EffectiveMessage.From.FirstName,
-				ctx.EffectiveMessage.From.LastName,
-			)
-		}
-	}
-
-	// If command is a reply - do the same but for replied message
-	if ctx.EffectiveMessage.ReplyToMessage != nil {
-		userId = ctx.EffectiveMessage.ReplyToMessage.From.Id
-		username = ctx.EffectiveMessage.ReplyToMessage.From.Username
-		if username == "" {
-			username = ctx.EffectiveMessage.ReplyToMessage.From.FirstName
-			if ctx.EffectiveMessage.ReplyToMessage.From.LastName != "" {
-				username = fmt.Sprintf(
-					"%v %v",
-					ctx.EffectiveMessage.ReplyToMessage.From.FirstName,
-					ctx.EffectiveMessage.ReplyToMessage.From.LastName,
-				)
-			}
-		}
-	}
-
-	rating, err := database.GetUserRating(ctx.EffectiveChat.Id, userId)
+	rating, err := h.store.GetUserRating(ctx.EffectiveChat.Id, userId)
 	if err != nil {
 		return err
 	}
 
 	message := fmt.Sprintf(
-		"%v: %v 👍 %v 👎 %v 🐳",
+		"%v: %v",
 		username,
-		rating.Likes,
-		rating.Dislikes,
-		rating.Whales,
+		formatRating(rating, categories, database.CategoryLike),
 	)
 
 	_, err = ctx.EffectiveMessage.Reply(bot, message, nil)
@@ -351,7 +191,7 @@ func rep(bot *gotgbot.Bot, ctx *ext.Context) error {
 	return nil
 }
 
-func reactions(bot *gotgbot.Bot, ctx *ext.Context) error {
+func (h handler) reactions(bot *gotgbot.Bot, ctx *ext.Context) error {
 	var id int64
 
 	if ctx.EffectiveMessage.ReplyToMessage != nil {
@@ -373,7 +213,7 @@ func reactions(bot *gotgbot.Bot, ctx *ext.Context) error {
 		id = num
 	}
 
-	reactions, err := database.GetReactions(ctx.EffectiveChat.Id, id)
+	reactions, err := h.store.GetReactions(ctx.EffectiveChat.Id, id)
 	if err != nil {
 		return err
 	}
@@ -387,32 +227,17 @@ func reactions(bot *gotgbot.Bot, ctx *ext.Context) error {
 		return nil
 	}
 
-	var resStr string
-
+	var userIds []int64
 	for _, x := range reactions {
-		var username string
+		userIds = append(userIds, x.UserId)
+	}
 
-		member, err := bot.GetChatMember(ctx.EffectiveChat.Id, x.UserId, nil)
-		if err != nil {
-			name, err := database.GetUsername(x.UserId)
-			if err != nil {
-				continue
-			}
+	h.names.Warm(bot, ctx.EffectiveChat.Id, userIds)
 
-			username = name
-		} else {
-			username = member.GetUser().Username
-			if username == "" {
-				username = member.GetUser().FirstName
-				if member.GetUser().LastName != "" {
-					username = fmt.Sprintf(
-						"%v %v",
-						member.GetUser().FirstName,
-						member.GetUser().LastName,
-					)
-				}
-			}
-		}
+	var resStr string
+
+	for _, x := range reactions {
+		username := h.names.Name(ctx.EffectiveChat.Id, x.UserId)
 
 		resStr += fmt.Sprintf("%v - %v\n", username, x.Reaction)
 	}
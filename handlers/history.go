@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/xbt573/flood-social-rep/models"
+	"github.com/xbt573/flood-social-rep/names"
+	"time"
+)
+
+// Names history handler, shows names user (or replied message author)
+// was seen with in chat
+func (h handler) nameHistory(bot *gotgbot.Bot, ctx *ext.Context) error {
+	user := ctx.EffectiveMessage.From
+	if ctx.EffectiveMessage.ReplyToMessage != nil {
+		user = ctx.EffectiveMessage.ReplyToMessage.From
+	}
+
+	history, err := h.store.GetNames(ctx.EffectiveChat.Id, user.Id)
+	if err != nil {
+		return err
+	}
+
+	if len(history) == 0 {
+		_, err := ctx.EffectiveMessage.Reply(bot, "Имена не найдены", nil)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	message := fmt.Sprintf("Имена %v:", names.Display(*user))
+
+	for _, name := range history {
+		message += fmt.Sprintf(
+			"\n%v: %v — %v",
+			formatName(name),
+			formatSeen(name.FirstSeen),
+			formatSeen(name.LastSeen),
+		)
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, message, nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// formatName returns name as "@username (Full Name)"
+func formatName(name models.Name) string {
+	switch {
+	case name.Username == "":
+		return name.FullName
+	case name.FullName == "":
+		return "@" + name.Username
+	}
+
+	return fmt.Sprintf("@%v (%v)", name.Username, name.FullName)
+}
+
+// formatSeen returns date name was seen, "?" if it's unknown
+func formatSeen(seen time.Time) string {
+	if seen.IsZero() {
+		return "?"
+	}
+
+	return seen.Format(dateLayout)
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/xbt573/flood-social-rep/database"
+	"github.com/xbt573/flood-social-rep/models"
+	"time"
+)
+
+// Moderators handler, grants user (replied message author, @username,
+// id or text mention) bot moderation rights: /repmod [user]. Without
+// user it lists chat moderators.
+func (h handler) repmod(bot *gotgbot.Bot, ctx *ext.Context) error {
+	if !hasTarget(ctx) {
+		return h.moderatorList(bot, ctx)
+	}
+
+	allowed, err := h.authorize(bot, ctx, appoint)
+	if err != nil || !allowed {
+		return err
+	}
+
+	target, _, err := h.resolveTarget(bot, ctx)
+	if err != nil {
+		return replyTargetError(bot, ctx, err)
+	}
+
+	err = h.audit(ctx, database.AuditModerator, target.UserId, nil, func(store database.Store) error {
+		return store.AddModerator(ctx.EffectiveChat.Id, models.Moderator{
+			UserId:    target.UserId,
+			ActorId:   actorId(ctx),
+			CreatedAt: time.Now(),
+		})
+	})
+	if err != nil {
+		if !errors.Is(err, database.ErrAlreadyModerator) {
+			return err
+		}
+
+		_, err := ctx.EffectiveMessage.Reply(bot, "Юзер уже модератор", nil)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, "Готово", nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Unmoderator handler, revokes user bot moderation rights:
+// /repunmod [user]
+func (h handler) repunmod(bot *gotgbot.Bot, ctx *ext.Context) error {
+	allowed, err := h.authorize(bot, ctx, appoint)
+	if err != nil || !allowed {
+		return err
+	}
+
+	target, _, err := h.resolveTarget(bot, ctx)
+	if err != nil {
+		return replyTargetError(bot, ctx, err)
+	}
+
+	err = h.audit(ctx, database.AuditUnmoderator, target.UserId, nil, func(store database.Store) error {
+		return store.RemoveModerator(ctx.EffectiveChat.Id, target.UserId)
+	})
+	if err != nil {
+		if !errors.Is(err, database.ErrNotModerator) {
+			return err
+		}
+
+		_, err := ctx.EffectiveMessage.Reply(bot, "Юзер не модератор", nil)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, "Готово", nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// moderatorList is a function which replies with chat bot moderators
+func (h handler) moderatorList(bot *gotgbot.Bot, ctx *ext.Context) error {
+	moderators, err := h.store.GetModerators(ctx.EffectiveChat.Id)
+	if err != nil {
+		return err
+	}
+
+	if len(moderators) == 0 {
+		_, err := ctx.EffectiveMessage.Reply(bot, "Модераторов нет", nil)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	var userIds []int64
+	for _, moderator := range moderators {
+		userIds = append(userIds, moderator.UserId)
+
+		if moderator.ActorId != 0 {
+			userIds = append(userIds, moderator.ActorId)
+		}
+	}
+
+	h.names.Warm(bot, ctx.EffectiveChat.Id, userIds)
+
+	message := "Модераторы:"
+
+	for _, moderator := range moderators {
+		message += "\n" + h.names.Name(ctx.EffectiveChat.Id, moderator.UserId)
+
+		if moderator.ActorId != 0 {
+			message += fmt.Sprintf(", от %v", h.names.Name(ctx.EffectiveChat.Id, moderator.ActorId))
+		}
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, message, nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/xbt573/flood-social-rep/database"
+	"strings"
+	"time"
+)
+
+// dateLayout is a layout of dates in period arguments
+const dateLayout = "2006-01-02"
+
+// periodUsage is a hint shown when period can't be parsed
+const periodUsage = "Период: day, week, month, all, дата (2006-01-02) или две даты"
+
+// parsePeriod parses period arguments: day, week, month, all, single
+// date or inclusive date range. Returns window, its human-readable
+// label and false if arguments are not a period.
+func parsePeriod(args []string, now time.Time) (database.Window, string, bool) {
+	switch len(args) {
+	case 0:
+		return database.AllTime, "", true
+
+	case 1:
+		switch strings.ToLower(args[0]) {
+		case "all":
+			return database.AllTime, "", true
+		case "day":
+			return database.Window{From: now.Add(-24 * time.Hour)}, "за день", true
+		case "week":
+			return database.Window{From: now.AddDate(0, 0, -7)}, "за неделю", true
+		case "month":
+			return database.Window{From: now.AddDate(0, -1, 0)}, "за месяц", true
+		}
+
+		date, err := time.ParseInLocation(dateLayout, args[0], now.Location())
+		if err != nil {
+			return database.Window{}, "", false
+		}
+
+		return database.Window{
+			From: date,
+			To:   date.AddDate(0, 0, 1),
+		}, fmt.Sprintf("за %v", args[0]), true
+
+	case 2:
+		from, err := time.ParseInLocation(dateLayout, args[0], now.Location())
+		if err != nil {
+			return database.Window{}, "", false
+		}
+
+		to, err := time.ParseInLocation(dateLayout, args[1], now.Location())
+		if err != nil || to.Before(from) {
+			return database.Window{}, "", false
+		}
+
+		return database.Window{
+			From: from,
+			To:   to.AddDate(0, 0, 1),
+		}, fmt.Sprintf("с %v по %v", args[0], args[1]), true
+	}
+
+	return database.Window{}, "", false
+}
+
+// withPeriod appends period label to top title
+func withPeriod(title, label string) string {
+	if label == "" {
+		return title + ":"
+	}
+
+	return fmt.Sprintf("%v %v:", title, label)
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// noRights is a reply to user without permission
+const noRights = "у тебя нет прав ALO🔉🔉🔉"
+
+// right is an admin right privileged command may require
+type right struct {
+	name string
+	has  func(admin gotgbot.ChatMemberAdministrator) bool
+}
+
+// Admin rights required by privileged commands
+var (
+	canRestrict = right{
+		name: "блокировать участников",
+		has:  func(admin gotgbot.ChatMemberAdministrator) bool { return admin.CanRestrictMembers },
+	}
+	canPromote = right{
+		name: "назначать администраторов",
+		has:  func(admin gotgbot.ChatMemberAdministrator) bool { return admin.CanPromoteMembers },
+	}
+)
+
+// permission is a requirement privileged command has. Chat creator
+// always has it, administrators need all rights, bot moderators
+// (granted with /repmod) need nothing if they are allowed.
+type permission struct {
+	rights     []right
+	moderators bool
+}
+
+// Permissions of privileged commands
+var (
+	// moderate is required to ignore users
+	moderate = permission{rights: []right{canRestrict}, moderators: true}
+
+	// configure is required to change chat rating settings
+	configure = permission{moderators: true}
+
+	// appoint is required to manage bot moderators
+	appoint = permission{rights: []right{canPromote}}
+)
+
+// lacking is a function which returns first right admin doesn't have,
+// nil if admin has all of them
+func (p permission) lacking(admin gotgbot.ChatMemberAdministrator) *right {
+	for _, r := range p.rights {
+		if !r.has(admin) {
+			return &r
+		}
+	}
+
+	return nil
+}
+
+// denial is a function which returns reply to user without permission,
+// missing right is mentioned if known
+func denial(missing *right) string {
+	if missing == nil {
+		return noRights
+	}
+
+	return fmt.Sprintf("%v (нужно право «%v»)", noRights, missing.name)
+}
+
+// isAnonymous is a function which reports whether command is sent by
+// anonymous admin, i.e. on behalf of the chat itself
+func isAnonymous(ctx *ext.Context) bool {
+	sender := ctx.EffectiveMessage.SenderChat
+	return sender != nil && sender.Id == ctx.EffectiveChat.Id
+}
+
+// actorId is a function which returns id of user who sent command,
+// zero if it's sent by anonymous admin
+func actorId(ctx *ext.Context) int64 {
+	if isAnonymous(ctx) {
+		return 0
+	}
+
+	return ctx.EffectiveUser.Id
+}
+
+// authorize is a function which reports whether command sender has
+// permission p, sender without it gets reply explaining why
+func (h handler) authorize(bot *gotgbot.Bot, ctx *ext.Context, p permission) (bool, error) {
+	reason, err := h.check(bot, ctx, p)
+	if err != nil {
+		return false, err
+	}
+
+	if reason == "" {
+		return true, nil
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, reason, nil)
+	if err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+// check is a function which returns denial reply if command sender
+// doesn't have permission p, empty string if they do
+func (h handler) check(bot *gotgbot.Bot, ctx *ext.Context, p permission) (string, error) {
+	chatId := ctx.EffectiveChat.Id
+
+	// Messages on behalf of other chats (channels, linked channel posts)
+	// have no user behind them to check
+	if ctx.EffectiveMessage.SenderChat != nil {
+		if !isAnonymous(ctx) {
+			return noRights, nil
+		}
+
+		return h.checkAnonymous(bot, chatId, p)
+	}
+
+	member, err := bot.GetChatMember(chatId, ctx.EffectiveUser.Id, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var missing *right
+
+	switch m := member.(type) {
+	case gotgbot.ChatMemberOwner:
+		return "", nil
+	case gotgbot.ChatMemberAdministrator:
+		missing = p.lacking(m)
+		if missing == nil {
+			return "", nil
+		}
+	case gotgbot.ChatMemberMember:
+	case gotgbot.ChatMemberRestricted:
+		if !m.IsMember {
+			return noRights, nil
+		}
+	default:
+		// left and banned users have no rights at all
+		return noRights, nil
+	}
+
+	if !p.moderators {
+		return denial(missing), nil
+	}
+
+	moderator, err := h.store.IsModerator(chatId, ctx.EffectiveUser.Id)
+	if err != nil {
+		return "", err
+	}
+
+	if !moderator {
+		return denial(missing), nil
+	}
+
+	return "", nil
+}
+
+// checkAnonymous is a function which returns denial reply if none of
+// anonymous admins of chatId has permission p, as it's unknown which
+// one of them sent command
+func (h handler) checkAnonymous(bot *gotgbot.Bot, chatId int64, p permission) (string, error) {
+	if len(p.rights) == 0 {
+		return "", nil
+	}
+
+	admins, err := bot.GetChatAdministrators(chatId, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var missing *right
+
+	for _, admin := range admins {
+		switch m := admin.(type) {
+		case gotgbot.ChatMemberOwner:
+			if m.IsAnonymous {
+				return "", nil
+			}
+		case gotgbot.ChatMemberAdministrator:
+			if !m.IsAnonymous {
+				continue
+			}
+
+			missing = p.lacking(m)
+			if missing == nil {
+				return "", nil
+			}
+		}
+	}
+
+	return denial(missing), nil
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/xbt573/flood-social-rep/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateLimitUsage is a hint shown when rate limit arguments can't be parsed
+const rateLimitUsage = "Использование: /replimit <окно (1m)> <реакций в окне> <реакций в день> [pair] или /replimit reset"
+
+// Rate limit handler, shows chat reactions rate limit or changes it:
+// /replimit <window> <burst> <daily> [pair]
+func (h handler) replimit(bot *gotgbot.Bot, ctx *ext.Context) error {
+	args := ctx.Args()[1:]
+
+	if len(args) == 0 {
+		policy, err := h.store.GetRateLimit(ctx.EffectiveChat.Id)
+		if err != nil {
+			return err
+		}
+
+		_, err = ctx.EffectiveMessage.Reply(bot, formatRateLimit(policy), nil)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	allowed, err := h.authorize(bot, ctx, configure)
+	if err != nil || !allowed {
+		return err
+	}
+
+	chatId := ctx.EffectiveChat.Id
+
+	change := func(store database.Store) error {
+		return store.ResetRateLimit(chatId)
+	}
+
+	if len(args) != 1 || strings.ToLower(args[0]) != "reset" {
+		policy, ok := parseRateLimit(args)
+		if !ok {
+			_, err := ctx.EffectiveMessage.Reply(bot, rateLimitUsage, nil)
+			if err != nil {
+				return err
+			}
+
+			return nil
+		}
+
+		change = func(store database.Store) error {
+			return store.SetRateLimit(chatId, policy)
+		}
+	}
+
+	err = h.audit(ctx, database.AuditRateLimit, 0, map[string]string{
+		"limit": strings.Join(args, " "),
+	}, change)
+	if err != nil {
+		return err
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, "Готово", nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// parseRateLimit parses rate limit arguments, returns false if they
+// are not valid
+func parseRateLimit(args []string) (database.RateLimit, bool) {
+	if len(args) != 3 && len(args) != 4 {
+		return database.RateLimit{}, false
+	}
+
+	window, err := time.ParseDuration(args[0])
+	if err != nil || window < time.Second {
+		return database.RateLimit{}, false
+	}
+
+	burst, err := strconv.Atoi(args[1])
+	if err != nil || burst < 0 {
+		return database.RateLimit{}, false
+	}
+
+	daily, err := strconv.Atoi(args[2])
+	if err != nil || daily < 0 {
+		return database.RateLimit{}, false
+	}
+
+	policy := database.RateLimit{
+		Window: window.Truncate(time.Second),
+		Burst:  burst,
+		Daily:  daily,
+	}
+
+	if len(args) == 4 {
+		if strings.ToLower(args[3]) != "pair" {
+			return database.RateLimit{}, false
+		}
+
+		policy.PerReceiver = true
+	}
+
+	return policy, true
+}
+
+// formatRateLimit returns human-readable rate limit policy
+func formatRateLimit(policy database.RateLimit) string {
+	limit := func(n int) string {
+		if n == 0 {
+			return "без лимита"
+		}
+
+		return strconv.Itoa(n)
+	}
+
+	counted := "на дарителя"
+	if policy.PerReceiver {
+		counted = "на пару даритель → получатель"
+	}
+
+	return fmt.Sprintf(
+		"Лимит реакций:\nза %v: %v (%v)\nв день: %v",
+		policy.Window,
+		limit(policy.Burst),
+		counted,
+		limit(policy.Daily),
+	)
+}
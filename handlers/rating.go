@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/xbt573/flood-social-rep/database"
+	"github.com/xbt573/flood-social-rep/models"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// labels are fixed labels of built-in categories
+var labels = map[string]string{
+	database.CategoryLike:    "👍",
+	database.CategoryDislike: "👎",
+	database.CategoryWhale:   "🐳",
+}
+
+// order is an order built-in categories are shown in
+var order = []string{
+	database.CategoryLike,
+	database.CategoryDislike,
+	database.CategoryWhale,
+}
+
+// categoryLabel returns emoji shown next to category count,
+// category name is used if there is no suitable emoji
+func categoryLabel(categories map[string]string, category string) string {
+	if label, exists := labels[category]; exists {
+		return label
+	}
+
+	var reactions []string
+	for reaction, x := range categories {
+		// custom emojis can't be shown in plain text
+		if x == category && !strings.HasPrefix(reaction, "custom:") {
+			reactions = append(reactions, reaction)
+		}
+	}
+
+	if len(reactions) == 0 {
+		return category
+	}
+
+	sort.Strings(reactions)
+
+	return reactions[0]
+}
+
+// chatCategories returns categories configured in chat, primary first,
+// then built-in ones, then the rest alphabetically
+func chatCategories(categories map[string]string, primary string) []string {
+	seen := map[string]bool{primary: true}
+	result := []string{primary}
+
+	for _, category := range order {
+		if !seen[category] {
+			seen[category] = true
+			result = append(result, category)
+		}
+	}
+
+	var rest []string
+	for _, category := range categories {
+		if !seen[category] {
+			seen[category] = true
+			rest = append(rest, category)
+		}
+	}
+
+	sort.Strings(rest)
+
+	return append(result, rest...)
+}
+
+// formatScore returns net score without trailing zeros
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// formatRating returns user rating as "5 👍 2 👎 1 🐳 ... (рейтинг 5.5)"
+func formatRating(user models.User, categories map[string]string, primary string) string {
+	var parts []string
+
+	for _, category := range chatCategories(categories, primary) {
+		parts = append(parts, fmt.Sprintf(
+			"%v %v",
+			user.Reactions[category],
+			categoryLabel(categories, category),
+		))
+	}
+
+	return fmt.Sprintf(
+		"%v (рейтинг %v)",
+		strings.Join(parts, " "),
+		formatScore(user.Score),
+	)
+}
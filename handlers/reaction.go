@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/xbt573/flood-social-rep/database"
+	"golang.org/x/exp/slog"
+	"time"
+)
+
+// Message tracking handler, remembers message authors for reaction updates
+// and their names
+func (h handler) track(bot *gotgbot.Bot, ctx *ext.Context) error {
+	sender := ctx.EffectiveMessage.GetSender()
+	if sender == nil {
+		return nil
+	}
+
+	err := h.store.AddMessage(
+		ctx.EffectiveChat.Id,
+		ctx.EffectiveMessage.MessageId,
+		sender.Id(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Keep names fresh, so leaderboards don't need to ask Telegram
+	if sender.User != nil {
+		return h.names.Remember(ctx.EffectiveChat.Id, *sender.User)
+	}
+
+	return nil
+}
+
+// Native reaction handler (message_reaction update)
+func (h handler) messageReaction(bot *gotgbot.Bot, ctx *ext.Context) error {
+	update := ctx.MessageReaction
+
+	// Anonymous admins react on behalf of chat
+	var fromUserId int64
+	switch {
+	case update.User != nil:
+		fromUserId = update.User.Id
+	case update.ActorChat != nil:
+		fromUserId = update.ActorChat.Id
+	default:
+		return nil
+	}
+
+	userId, err := h.store.GetMessageAuthor(update.Chat.Id, update.MessageId)
+	if err != nil {
+		if !errors.Is(err, database.ErrUnknownMessage) {
+			return err
+		}
+
+		slog.Debug(
+			"Reaction on unknown message, skipping",
+			slog.Int64("chat_id", update.Chat.Id),
+			slog.Int64("message_id", update.MessageId),
+		)
+		return nil
+	}
+
+	// Reactions which are gone from new list were taken back
+	for _, old := range update.OldReaction {
+		key := reactionKey(old)
+		if hasReaction(update.NewReaction, key) {
+			continue
+		}
+
+		err := h.store.RemoveReaction(
+			update.Chat.Id,
+			fromUserId,
+			update.MessageId,
+			key,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, x := range update.NewReaction {
+		err := h.store.AddReaction(
+			update.Chat.Id,
+			fromUserId,
+			userId,
+			update.MessageId,
+			reactionKey(x),
+			time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reactionKey returns key reaction is stored with
+func reactionKey(reaction gotgbot.ReactionType) string {
+	merged := reaction.MergeReactionType()
+	return database.ReactionKey(merged.Emoji, merged.CustomEmojiId)
+}
+
+// hasReaction reports whether reactions list contains reaction with key
+func hasReaction(reactions []gotgbot.ReactionType, key string) bool {
+	for _, x := range reactions {
+		if reactionKey(x) == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Anonymous reaction counter handler (message_reaction_count update).
+// Telegram doesn't tell who reacted, so there is nobody to attribute
+// reactions from, only logging.
+func (h handler) messageReactionCount(bot *gotgbot.Bot, ctx *ext.Context) error {
+	update := ctx.MessageReactionCount
+
+	slog.Debug(
+		"Anonymous reaction count update, skipping",
+		slog.Int64("chat_id", update.Chat.Id),
+		slog.Int64("message_id", update.MessageId),
+		slog.Int("reactions", len(update.Reactions)),
+	)
+
+	return nil
+}
+
+// reactionCountHandler is a dispatcher handler for message_reaction_count
+// updates, gotgbot doesn't provide one.
+type reactionCountHandler struct {
+	response handlers.Response
+}
+
+func (r reactionCountHandler) CheckUpdate(bot *gotgbot.Bot, ctx *ext.Context) bool {
+	return ctx.MessageReactionCount != nil
+}
+
+func (r reactionCountHandler) HandleUpdate(bot *gotgbot.Bot, ctx *ext.Context) error {
+	return r.response(bot, ctx)
+}
+
+func (r reactionCountHandler) Name() string {
+	return "reaction_count"
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/xbt573/flood-social-rep/database"
+	"sort"
+	"strings"
+)
+
+// Reaction map handler, shows chat reaction categories or changes them:
+// /reactionmap <reaction> <category|none|reset>
+func (h handler) reactionmap(bot *gotgbot.Bot, ctx *ext.Context) error {
+	args := ctx.Args()[1:]
+
+	if len(args) == 0 {
+		categories, err := h.store.GetReactionMap(ctx.EffectiveChat.Id)
+		if err != nil {
+			return err
+		}
+
+		_, err = ctx.EffectiveMessage.Reply(bot, formatReactionMap(categories), nil)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	allowed, err := h.authorize(bot, ctx, configure)
+	if err != nil || !allowed {
+		return err
+	}
+
+	if len(args) != 2 {
+		_, err := ctx.EffectiveMessage.Reply(
+			bot,
+			"Использование: /reactionmap <реакция> <категория|none|reset>",
+			nil,
+		)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	reaction := args[0]
+
+	// Custom emoji is sent as entity, its id is what reactions carry
+	for _, entity := range ctx.EffectiveMessage.Entities {
+		if entity.Type == "custom_emoji" {
+			reaction = database.ReactionKey("", entity.CustomEmojiId)
+			break
+		}
+	}
+
+	chatId := ctx.EffectiveChat.Id
+	category := strings.ToLower(args[1])
+
+	err = h.audit(ctx, database.AuditReactionMap, 0, map[string]string{
+		"reaction": reaction,
+		"category": category,
+	}, func(store database.Store) error {
+		if category == "reset" {
+			return store.ResetReactionCategory(chatId, reaction)
+		}
+
+		return store.SetReactionCategory(chatId, reaction, category)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, "Готово", nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// formatReactionMap returns reaction map grouped by categories
+func formatReactionMap(categories map[string]string) string {
+	grouped := map[string][]string{}
+
+	for reaction, category := range categories {
+		grouped[category] = append(grouped[category], reaction)
+	}
+
+	var names []string
+	for category := range grouped {
+		names = append(names, category)
+	}
+
+	sort.Strings(names)
+
+	message := "Категории реакций:"
+
+	for _, category := range names {
+		reactions := grouped[category]
+		sort.Strings(reactions)
+
+		message += fmt.Sprintf("\n%v: %v", category, strings.Join(reactions, " "))
+	}
+
+	return message
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/xbt573/flood-social-rep/database"
+	"github.com/xbt573/flood-social-rep/names"
+	"strconv"
+	"strings"
+)
+
+// targetError is an error explaining why command target can't be
+// resolved, it's replied to user as is
+type targetError string
+
+func (e targetError) Error() string {
+	return string(e)
+}
+
+// errNoTarget is returned when command has neither reply nor target argument
+const errNoTarget = targetError("Укажи юзера: ответом на сообщение, @username, id или упоминанием")
+
+// target is a user command is aimed at
+type target struct {
+	UserId int64
+	Name   string
+}
+
+// hasTarget is a function which reports whether command is a reply or
+// has arguments, so target should be resolved
+func hasTarget(ctx *ext.Context) bool {
+	return ctx.EffectiveMessage.ReplyToMessage != nil || len(ctx.Args()) > 1
+}
+
+// resolveTarget is a function which returns user command is aimed at
+// and command arguments left after target. Target is replied message
+// author, or first argument: text mention, @username (looked up in
+// names history) or user id. Returns targetError if target can't be
+// resolved.
+func (h handler) resolveTarget(bot *gotgbot.Bot, ctx *ext.Context) (target, []string, error) {
+	msg := ctx.EffectiveMessage
+	args := ctx.Args()
+
+	if msg.ReplyToMessage != nil {
+		return target{
+			UserId: msg.ReplyToMessage.From.Id,
+			Name:   names.Display(*msg.ReplyToMessage.From),
+		}, args[1:], nil
+	}
+
+	if len(args) < 2 {
+		return target{}, nil, errNoTarget
+	}
+
+	// Text mention is a name linked to user without username, it may
+	// span several arguments, so it's looked up in entities
+	mentions := msg.ParseEntityTypes(map[string]struct{}{"text_mention": {}})
+	for _, mention := range mentions {
+		if mention.User == nil ||
+			mention.Offset < int64(len(args[0])) ||
+			strings.TrimSpace(msg.Text[len(args[0]):mention.Offset]) != "" {
+			continue
+		}
+
+		return target{
+			UserId: mention.User.Id,
+			Name:   names.Display(*mention.User),
+		}, strings.Fields(msg.Text[mention.Offset+mention.Length:]), nil
+	}
+
+	arg := args[1]
+
+	if username, found := strings.CutPrefix(arg, "@"); found {
+		userId, err := h.store.FindUser(ctx.EffectiveChat.Id, username)
+		if err != nil {
+			if !errors.Is(err, database.ErrUnknownUser) {
+				return target{}, nil, err
+			}
+
+			return target{}, nil, targetError(fmt.Sprintf(
+				"Не знаю %v: такой юзер ещё не встречался в этом чате, ответь на сообщение юзера или укажи id",
+				arg,
+			))
+		}
+
+		h.names.Warm(bot, ctx.EffectiveChat.Id, []int64{userId})
+
+		return target{
+			UserId: userId,
+			Name:   h.names.Name(ctx.EffectiveChat.Id, userId),
+		}, args[2:], nil
+	}
+
+	userId, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || userId <= 0 {
+		return target{}, nil, targetError(fmt.Sprintf(
+			"Не понял, кто такой %v: нужен ответ на сообщение, @username, id или упоминание",
+			arg,
+		))
+	}
+
+	h.names.Warm(bot, ctx.EffectiveChat.Id, []int64{userId})
+
+	return target{
+		UserId: userId,
+		Name:   h.names.Name(ctx.EffectiveChat.Id, userId),
+	}, args[2:], nil
+}
+
+// replyTargetError is a function which replies targetError to user,
+// other errors are returned
+func replyTargetError(bot *gotgbot.Bot, ctx *ext.Context, err error) error {
+	var reason targetError
+	if !errors.As(err, &reason) {
+		return err
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, reason.Error(), nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
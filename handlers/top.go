@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/xbt573/flood-social-rep/database"
+	"github.com/xbt573/flood-social-rep/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// topPrefix is a prefix of leaderboard callback data
+const topPrefix = "top|"
+
+// topNoop is a callback data of buttons which do nothing
+const topNoop = topPrefix + "-"
+
+// topPageSize is a number of users shown on leaderboard page
+const topPageSize = 10
+
+// topScore is a pseudo-category of leaderboard ranked by net score
+const topScore = ""
+
+// callbackDataLimit is a maximum callback data length Telegram accepts
+const callbackDataLimit = 64
+
+// topTitles are titles of built-in leaderboards
+var topTitles = map[string]string{
+	topScore:                 "Топ социального рейтинга",
+	database.CategoryLike:    "Топ рейтинга",
+	database.CategoryDislike: "Топ рейтинга (наоборот)",
+	database.CategoryWhale:   "Топ рейтинга по китам",
+}
+
+// topQuery is a leaderboard state, kept in inline keyboard callback data
+type topQuery struct {
+	Category string
+	Period   []string
+	Page     int
+}
+
+// data encodes query as callback data: "top|<page>|<period>|<category>"
+func (q topQuery) data() string {
+	return fmt.Sprintf("%v%v|%v|%v", topPrefix, q.Page, strings.Join(q.Period, " "), q.Category)
+}
+
+// parseTopQuery decodes query from callback data, returns false if
+// data is not a query
+func parseTopQuery(data string) (topQuery, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(data, topPrefix), "|", 3)
+	if len(parts) != 3 {
+		return topQuery{}, false
+	}
+
+	page, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return topQuery{}, false
+	}
+
+	return topQuery{
+		Category: parts[2],
+		Period:   strings.Fields(parts[1]),
+		Page:     page,
+	}, true
+}
+
+// topTitle returns leaderboard title of category
+func topTitle(category string) string {
+	if title, exists := topTitles[category]; exists {
+		return title
+	}
+
+	return fmt.Sprintf("Топ рейтинга (%v)", category)
+}
+
+// Like top handler, alias of /top like
+func (h handler) liketop(bot *gotgbot.Bot, ctx *ext.Context) error {
+	return h.showTop(bot, ctx, database.CategoryLike, ctx.Args()[1:])
+}
+
+// Dislike top handler, alias of /top dislike
+func (h handler) disliketop(bot *gotgbot.Bot, ctx *ext.Context) error {
+	return h.showTop(bot, ctx, database.CategoryDislike, ctx.Args()[1:])
+}
+
+// Whale reputation top handler, alias of /top whale
+func (h handler) whaletop(bot *gotgbot.Bot, ctx *ext.Context) error {
+	return h.showTop(bot, ctx, database.CategoryWhale, ctx.Args()[1:])
+}
+
+// Top handler: /top [period] ranks by net score,
+// /top <category> [period] by category
+func (h handler) top(bot *gotgbot.Bot, ctx *ext.Context) error {
+	args := ctx.Args()[1:]
+
+	if _, _, ok := parsePeriod(args, time.Now()); ok {
+		return h.showTop(bot, ctx, topScore, args)
+	}
+
+	return h.showTop(bot, ctx, strings.ToLower(args[0]), args[1:])
+}
+
+// showTop replies with first leaderboard page of category in period
+func (h handler) showTop(bot *gotgbot.Bot, ctx *ext.Context, category string, period []string) error {
+	text, keyboard, ok, err := h.renderTop(bot, ctx.EffectiveChat.Id, topQuery{
+		Category: category,
+		Period:   period,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		_, err := ctx.EffectiveMessage.Reply(bot, periodUsage, nil)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, text, &gotgbot.SendMessageOpts{
+		ReplyMarkup: keyboard,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Leaderboard keyboard handler, edits leaderboard message in place
+func (h handler) topCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
+	cq := ctx.CallbackQuery
+
+	query, ok := parseTopQuery(cq.Data)
+	if !ok || cq.Message == nil {
+		_, err := cq.Answer(bot, nil)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	chatId := cq.Message.GetChat().Id
+
+	text, keyboard, ok, err := h.renderTop(bot, chatId, query)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		_, err := cq.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: periodUsage})
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	_, err = cq.Answer(bot, nil)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = bot.EditMessageText(text, &gotgbot.EditMessageTextOpts{
+		ChatId:      chatId,
+		MessageId:   cq.Message.GetMessageId(),
+		ReplyMarkup: keyboard,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// renderTop returns leaderboard page and its keyboard, false if query
+// period is not valid. Users with zero value are not ranked.
+func (h handler) renderTop(
+	bot *gotgbot.Bot,
+	chatId int64,
+	query topQuery,
+) (string, gotgbot.InlineKeyboardMarkup, bool, error) {
+	window, label, ok := parsePeriod(query.Period, time.Now())
+	if !ok {
+		return "", gotgbot.InlineKeyboardMarkup{}, false, nil
+	}
+
+	categories, err := h.store.GetReactionMap(chatId)
+	if err != nil {
+		return "", gotgbot.InlineKeyboardMarkup{}, false, err
+	}
+
+	top, err := h.store.TopRating(chatId, window)
+	if err != nil {
+		return "", gotgbot.InlineKeyboardMarkup{}, false, err
+	}
+
+	value := func(user models.User) float64 {
+		if query.Category == topScore {
+			return user.Score
+		}
+
+		return float64(user.Reactions[query.Category])
+	}
+
+	var ranked []models.User
+	for _, user := range top {
+		if value(user) != 0 {
+			ranked = append(ranked, user)
+		}
+	}
+
+	// Ties are broken by user id, so pages are stable between clicks
+	sort.Slice(ranked, func(i, j int) bool {
+		if value(ranked[i]) != value(ranked[j]) {
+			return value(ranked[i]) > value(ranked[j])
+		}
+
+		return ranked[i].UserId < ranked[j].UserId
+	})
+
+	pages := (len(ranked) + topPageSize - 1) / topPageSize
+
+	page := query.Page
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	start := page * topPageSize
+	end := start + topPageSize
+	if end > len(ranked) {
+		end = len(ranked)
+	}
+
+	primary := query.Category
+	if primary == topScore {
+		primary = database.CategoryLike
+	}
+
+	var userIds []int64
+	for _, user := range ranked[start:end] {
+		userIds = append(userIds, user.UserId)
+	}
+
+	h.names.Warm(bot, chatId, userIds)
+
+	text := withPeriod(topTitle(query.Category), label)
+
+	for _, user := range ranked[start:end] {
+		text += fmt.Sprintf(
+			"\n%v: %v",
+			h.names.Name(chatId, user.UserId),
+			formatRating(user, categories, primary),
+		)
+	}
+
+	var keyboard [][]gotgbot.InlineKeyboardButton
+
+	if pages > 1 {
+		var nav []gotgbot.InlineKeyboardButton
+
+		if page > 0 {
+			nav = append(nav, gotgbot.InlineKeyboardButton{
+				Text:         "◀",
+				CallbackData: topQuery{query.Category, query.Period, page - 1}.data(),
+			})
+		}
+
+		nav = append(nav, gotgbot.InlineKeyboardButton{
+			Text:         fmt.Sprintf("%v/%v", page+1, pages),
+			CallbackData: topNoop,
+		})
+
+		if page < pages-1 {
+			nav = append(nav, gotgbot.InlineKeyboardButton{
+				Text:         "▶",
+				CallbackData: topQuery{query.Category, query.Period, page + 1}.data(),
+			})
+		}
+
+		keyboard = append(keyboard, nav)
+	}
+
+	var row []gotgbot.InlineKeyboardButton
+
+	switches := append([]string{topScore}, chatCategories(categories, database.CategoryLike)...)
+	for _, category := range switches {
+		caption := "рейтинг"
+		if category != topScore {
+			caption = categoryLabel(categories, category)
+		}
+
+		data := topQuery{category, query.Period, 0}.data()
+		if category == query.Category {
+			caption = "• " + caption
+			data = topNoop
+		}
+
+		if len(data) > callbackDataLimit {
+			continue
+		}
+
+		row = append(row, gotgbot.InlineKeyboardButton{Text: caption, CallbackData: data})
+
+		if len(row) == 4 {
+			keyboard = append(keyboard, row)
+			row = nil
+		}
+	}
+
+	if len(row) > 0 {
+		keyboard = append(keyboard, row)
+	}
+
+	return text, gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboard}, true, nil
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/xbt573/flood-social-rep/database"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Score weights handler, shows chat category weights or changes them:
+// /repweight <category> <weight|reset>
+func (h handler) repweight(bot *gotgbot.Bot, ctx *ext.Context) error {
+	args := ctx.Args()[1:]
+
+	if len(args) == 0 {
+		weights, err := h.store.GetWeights(ctx.EffectiveChat.Id)
+		if err != nil {
+			return err
+		}
+
+		var categories []string
+		for category := range weights {
+			categories = append(categories, category)
+		}
+
+		sort.Strings(categories)
+
+		message := "Веса категорий:"
+
+		for _, category := range categories {
+			message += fmt.Sprintf("\n%v: %v", category, formatScore(weights[category]))
+		}
+
+		_, err = ctx.EffectiveMessage.Reply(bot, message, nil)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	allowed, err := h.authorize(bot, ctx, configure)
+	if err != nil || !allowed {
+		return err
+	}
+
+	if len(args) != 2 {
+		_, err := ctx.EffectiveMessage.Reply(
+			bot,
+			"Использование: /repweight <категория> <вес|reset>",
+			nil,
+		)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	chatId := ctx.EffectiveChat.Id
+	category := strings.ToLower(args[0])
+
+	change := func(store database.Store) error {
+		return store.ResetWeight(chatId, category)
+	}
+
+	if strings.ToLower(args[1]) != "reset" {
+		// NaN and infinities would break every score and tops order
+		weight, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			_, err := ctx.EffectiveMessage.Reply(bot, "Вес должен быть конечным числом", nil)
+			if err != nil {
+				return err
+			}
+
+			return nil
+		}
+
+		change = func(store database.Store) error {
+			return store.SetWeight(chatId, category, weight)
+		}
+	}
+
+	err = h.audit(ctx, database.AuditWeight, 0, map[string]string{
+		"category": category,
+		"weight":   strings.ToLower(args[1]),
+	}, change)
+	if err != nil {
+		return err
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, "Готово", nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
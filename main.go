@@ -6,7 +6,7 @@ import (
 )
 
 func main() {
-	err := cmd.Run()
+	err := cmd.Execute(os.Args[1:])
 	if err != nil {
 		os.Exit(1)
 	}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Adjustment is a manual rating correction made by admin in chat
+type Adjustment struct {
+	// Id is an adjustment ID, adjustments are ordered by it
+	Id int64
+
+	// UserId is an adjusted user ID
+	UserId int64
+
+	// ActorId is an ID of admin who made adjustment, zero if unknown
+	ActorId int64
+
+	// Category is an adjusted rating category, empty for reset
+	Category string
+
+	// Amount is added to user category count, may be negative
+	Amount int
+
+	// Reset zeroes user rating: reactions and adjustments user got
+	// before it are not counted anymore
+	Reset bool
+
+	// Reason is why adjustment was made, may be empty
+	Reason string
+
+	// CreatedAt is a time adjustment was made at
+	CreatedAt time.Time
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// APIKey is a webserver key, it signs requests of its chats only
+type APIKey struct {
+	// Id is a public key ID sent with requests
+	Id string
+
+	// Secret is a key requests are signed with
+	Secret string
+
+	// ChatIds are IDs of chats key is allowed to post reactions of
+	ChatIds []int64
+
+	// CreatedAt is a time key was created at
+	CreatedAt time.Time
+
+	// ExpiresAt is a time key lapses at, zero if never
+	ExpiresAt time.Time
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// AuditEntry is a privileged action made in chat
+type AuditEntry struct {
+	// Id is an entry ID, entries are ordered by it
+	Id int64 `json:"id"`
+
+	// ChatId is a chat ID action was made in
+	ChatId int64 `json:"chat_id"`
+
+	// ActorId is an ID of user who made action, zero if unknown
+	// (e.g. anonymous admin)
+	ActorId int64 `json:"actor_id"`
+
+	// TargetId is an ID of user action was aimed at, zero if none
+	TargetId int64 `json:"target_id,omitempty"`
+
+	// Action is an action name, e.g. ignore or weight
+	Action string `json:"action"`
+
+	// Params are action parameters, e.g. reason or new value
+	Params map[string]string `json:"params,omitempty"`
+
+	// CreatedAt is a time action was made at
+	CreatedAt time.Time `json:"created_at"`
+}
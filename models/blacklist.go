@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// BlacklistEntry is a user ignored by rating in chat
+type BlacklistEntry struct {
+	// UserId is an ignored user ID
+	UserId int64
+
+	// Mode is what user can't do: receive, give or both
+	Mode string
+
+	// ActorId is an ID of admin who ignored user, zero if unknown
+	ActorId int64
+
+	// Reason is why user was ignored, may be empty
+	Reason string
+
+	// CreatedAt is a time user was ignored at, zero if unknown
+	CreatedAt time.Time
+
+	// ExpiresAt is a time entry lapses at, zero if never
+	ExpiresAt time.Time
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Moderator is a user granted bot moderation rights in chat
+type Moderator struct {
+	// UserId is a moderator user ID
+	UserId int64
+
+	// ActorId is an ID of admin who granted rights
+	ActorId int64
+
+	// CreatedAt is a time rights were granted at
+	CreatedAt time.Time
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Name is a name user was seen with in chat
+type Name struct {
+	// User ID, 64 bit
+	UserId int64
+
+	// Username without @, empty if user had no username
+	Username string
+
+	// FullName is first and last name
+	FullName string
+
+	// FirstSeen and LastSeen are times name was seen first and last,
+	// zero if unknown
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
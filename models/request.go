@@ -32,6 +32,9 @@ type Request struct {
 		// Reactions -> Emoji is emoji itself
 		Emoji string `json:"emoji"`
 
+		// Reactions -> CustomEmojiId is custom emoji identifier
+		CustomEmojiId string `json:"custom_emoji_id,omitempty"`
+
 		// From is a Telegram user entity
 		From struct {
 			// From -> Id is a User ID which set reaction
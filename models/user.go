@@ -6,12 +6,9 @@ type User struct {
 	// User ID, 64 bit
 	UserId int64
 
-	// User likes
-	Likes int
+	// User reactions count per category (likes, dislikes, whales 🐳, ...)
+	Reactions map[string]int
 
-	// User dislikes
-	Dislikes int
-
-	// User whales 🐳
-	Whales int
+	// User net score, sum of category counts multiplied by chat weights
+	Score float64
 }
@@ -0,0 +1,224 @@
+// Package names is used to resolve user display names.
+package names
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/xbt573/flood-social-rep/database"
+	"github.com/xbt573/flood-social-rep/models"
+	"golang.org/x/exp/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FullName is a function which returns first and last name joined
+func FullName(firstName, lastName string) string {
+	if lastName != "" {
+		return fmt.Sprintf("%v %v", firstName, lastName)
+	}
+
+	return firstName
+}
+
+// Display is a function which returns user display name: username,
+// or full name if there is no username
+func Display(user gotgbot.User) string {
+	return display(user.Username, FullName(user.FirstName, user.LastName))
+}
+
+// display is a function which returns username, or full name if
+// there is no username
+func display(username, fullName string) string {
+	if username != "" {
+		return username
+	}
+
+	return fullName
+}
+
+// chatUser is a pair of chat and user ids, cache is indexed by it
+type chatUser struct {
+	chatId int64
+	userId int64
+}
+
+// entry is a cached name, empty for user whose name can't be resolved
+type entry struct {
+	username string
+	fullName string
+	expires  time.Time
+}
+
+// fallbackTTL is a time users whose names can't be resolved are not
+// looked up again for
+const fallbackTTL = 10 * time.Minute
+
+// cacheSweep is a minimum number of cached names which makes cache drop
+// expired ones
+const cacheSweep = 1024
+
+// Resolver is a display name resolver, it caches latest names users
+// were seen with in chats in memory and looks them up in store names
+// history first, then in Telegram. Users whose names can't be resolved
+// are cached too, so they are not looked up on every render.
+type Resolver struct {
+	store database.Store
+	ttl   time.Duration
+	cache map[chatUser]entry
+
+	// sweepAt is a cache size expired names are dropped at
+	sweepAt int
+
+	// mux is sync.Mutex which is locked where cache is accessed
+	mux sync.Mutex
+}
+
+// New is a function which creates Resolver keeping names for ttl
+func New(store database.Store, ttl time.Duration) *Resolver {
+	return &Resolver{
+		store:   store,
+		ttl:     ttl,
+		cache:   map[chatUser]entry{},
+		sweepAt: cacheSweep,
+	}
+}
+
+// Remember is a function which caches name of user seen in chatId
+// and records it into store names history. Unchanged names are
+// recorded once per ttl, so history last seen time is that precise.
+func (r *Resolver) Remember(chatId int64, user gotgbot.User) error {
+	key := chatUser{chatId, user.Id}
+	fullName := FullName(user.FirstName, user.LastName)
+	now := time.Now()
+
+	r.mux.Lock()
+	cached, exists := r.cache[key]
+	r.put(key, entry{username: user.Username, fullName: fullName, expires: now.Add(r.ttl)}, now)
+	r.mux.Unlock()
+
+	if exists &&
+		cached.username == user.Username &&
+		cached.fullName == fullName &&
+		now.Before(cached.expires) {
+		return nil
+	}
+
+	return r.store.AddName(chatId, user.Id, user.Username, fullName, now)
+}
+
+// Warm is a function which resolves names of users missing in cache
+// at once: from store with single query, then from chatId members.
+// Failures are logged, such users get fallback name until fallbackTTL
+// passes. It's the only place names are looked up in, so it's called
+// before names are rendered.
+func (r *Resolver) Warm(bot *gotgbot.Bot, chatId int64, userIds []int64) {
+	missing := r.missing(chatId, userIds)
+	if len(missing) == 0 {
+		return
+	}
+
+	stored, err := r.store.GetLatestNames(chatId, missing)
+	if err != nil {
+		slog.Warn("Failed to get names", slog.String("err", err.Error()))
+		stored = map[int64]models.Name{}
+	}
+
+	for _, userId := range missing {
+		name, exists := stored[userId]
+		if !exists {
+			member, err := bot.GetChatMember(chatId, userId, nil)
+			if err != nil {
+				slog.Debug(
+					"Failed to resolve name",
+					slog.Int64("user_id", userId),
+					slog.String("err", err.Error()),
+				)
+
+				now := time.Now()
+
+				r.mux.Lock()
+				r.put(chatUser{chatId, userId}, entry{expires: now.Add(fallbackTTL)}, now)
+				r.mux.Unlock()
+
+				continue
+			}
+
+			err = r.Remember(chatId, member.GetUser())
+			if err != nil {
+				slog.Warn("Failed to save name", slog.String("err", err.Error()))
+			}
+
+			continue
+		}
+
+		now := time.Now()
+
+		r.mux.Lock()
+		r.put(chatUser{chatId, userId}, entry{
+			username: name.Username,
+			fullName: name.FullName,
+			expires:  now.Add(r.ttl),
+		}, now)
+		r.mux.Unlock()
+	}
+}
+
+// Name is a function which returns cached display name of user in
+// chatId, user id is returned if name is not resolved by Warm
+func (r *Resolver) Name(chatId, userId int64) string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	cached := r.cache[chatUser{chatId, userId}]
+	if name := display(cached.username, cached.fullName); name != "" {
+		return name
+	}
+
+	return strconv.FormatInt(userId, 10)
+}
+
+// missing is a function which returns userIds without fresh cache
+// entry in chatId
+func (r *Resolver) missing(chatId int64, userIds []int64) []int64 {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	now := time.Now()
+
+	var missing []int64
+	seen := map[int64]bool{}
+
+	for _, userId := range userIds {
+		cached, exists := r.cache[chatUser{chatId, userId}]
+		if exists && now.Before(cached.expires) || seen[userId] {
+			continue
+		}
+
+		seen[userId] = true
+		missing = append(missing, userId)
+	}
+
+	return missing
+}
+
+// put is a function which caches name under key, expired names are
+// dropped once cache doubles since last sweep. Mux must be locked.
+func (r *Resolver) put(key chatUser, cached entry, now time.Time) {
+	r.cache[key] = cached
+
+	if len(r.cache) < r.sweepAt {
+		return
+	}
+
+	for key, cached := range r.cache {
+		if !now.Before(cached.expires) {
+			delete(r.cache, key)
+		}
+	}
+
+	r.sweepAt = 2 * len(r.cache)
+	if r.sweepAt < cacheSweep {
+		r.sweepAt = cacheSweep
+	}
+}
@@ -0,0 +1,61 @@
+package names
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/xbt573/flood-social-rep/database"
+	"testing"
+	"time"
+)
+
+// fakeClient is a gotgbot.BotClient which fails every request and
+// counts them
+type fakeClient struct {
+	gotgbot.BaseBotClient
+	requests int
+}
+
+// RequestWithContext is a function which counts request and fails it
+func (c *fakeClient) RequestWithContext(
+	ctx context.Context,
+	token string,
+	method string,
+	params map[string]string,
+	data map[string]gotgbot.NamedReader,
+	opts *gotgbot.RequestOpts,
+) (json.RawMessage, error) {
+	c.requests++
+	return nil, errors.New("user not found")
+}
+
+// Users whose names can't be resolved are looked up in Telegram once,
+// rendering names doesn't look them up at all
+func TestResolverFallback(t *testing.T) {
+	client := &fakeClient{}
+	bot := &gotgbot.Bot{BotClient: client}
+
+	resolver := New(database.NewMemory(database.DefaultRegistry()), time.Hour)
+
+	for i := 0; i < 3; i++ {
+		resolver.Warm(bot, 1, []int64{2, 3, 2})
+
+		if name := resolver.Name(1, 2); name != "2" {
+			t.Errorf("name = %v, want 2", name)
+		}
+	}
+
+	if client.requests != 2 {
+		t.Errorf("requests = %v, want 2", client.requests)
+	}
+
+	err := resolver.Remember(1, gotgbot.User{Id: 2, FirstName: "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name := resolver.Name(1, 2); name != "A" {
+		t.Errorf("name = %v, want A", name)
+	}
+}
@@ -0,0 +1,337 @@
+package webserver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/xbt573/flood-social-rep/database"
+	"github.com/xbt573/flood-social-rep/models"
+	"golang.org/x/exp/slices"
+	"golang.org/x/exp/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Signature headers
+const (
+	// HeaderKeyId is a header with id of API key request is signed
+	// with, global keys are used without it
+	HeaderKeyId = "X-Signature-Key"
+
+	// HeaderTimestamp is a header with request unix time in seconds
+	HeaderTimestamp = "X-Signature-Timestamp"
+
+	// HeaderNonce is a header with unique request string
+	HeaderNonce = "X-Signature-Nonce"
+
+	// HeaderSignature is a header with hex HMAC-SHA256 of
+	// "timestamp.nonce.method.uri.body", uri is path with raw query
+	HeaderSignature = "X-Signature"
+)
+
+// DefaultWindow is a time signed request is accepted in by default
+const DefaultWindow = 5 * time.Minute
+
+// scopeLocal is a request local with ids of chats API key is allowed
+// to access, requests without it can access any chat
+const scopeLocal = "scope"
+
+// signedLocal is a request local set on requests signed with global or
+// API key, legacy key and open requests are not signed
+const signedLocal = "signed"
+
+// nonceSweep is a minimum number of nonces which makes cache drop
+// expired ones
+const nonceSweep = 1024
+
+// Auth is a requests authenticator. Requests are signed with one of
+// global keys (several keys are used during rotation) or with chat
+// scoped API key from store, signed request is accepted once and only
+// in window around its timestamp. Legacy query key is accepted too if
+// it's enabled.
+type Auth struct {
+	store  database.Store
+	keys   [][]byte
+	window time.Duration
+
+	legacyKey     string
+	legacyEnabled bool
+
+	// nonces are used nonces with time they expire at
+	nonces map[string]time.Time
+
+	// sweepAt is a nonces count expired ones are dropped at
+	sweepAt int
+
+	// mux is sync.Mutex which is locked where nonces are accessed
+	mux sync.Mutex
+}
+
+// NewAuth is a function which creates Auth accepting requests signed
+// in window with any of keys or store API keys, and requests with
+// legacyKey in "key" query parameter if legacyEnabled. Requests are not
+// authenticated at all if there are no keys of any kind and legacy key
+// is disabled.
+func NewAuth(
+	store database.Store,
+	keys []string,
+	window time.Duration,
+	legacyKey string,
+	legacyEnabled bool,
+) *Auth {
+	a := &Auth{
+		store:         store,
+		window:        window,
+		legacyKey:     legacyKey,
+		legacyEnabled: legacyEnabled,
+		nonces:        map[string]time.Time{},
+		sweepAt:       nonceSweep,
+	}
+
+	for _, key := range keys {
+		a.keys = append(a.keys, []byte(key))
+	}
+
+	return a
+}
+
+// Sign is a function which returns signature of request to uri (path
+// with raw query) with method and body sent at timestamp with nonce,
+// signed with key. Request line is signed, so signed body can't be
+// replayed to another endpoint or with another query.
+func Sign(key []byte, timestamp int64, nonce, method, uri string, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "." + nonce + "." + method + "." + uri + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewAPIKey is a function which generates random API key scoped to
+// chatIds, it expires after ttl (never if ttl is zero)
+func NewAPIKey(chatIds []int64, ttl time.Duration) (models.APIKey, error) {
+	random := make([]byte, 40)
+
+	_, err := rand.Read(random)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	key := models.APIKey{
+		Id:        hex.EncodeToString(random[:8]),
+		Secret:    hex.EncodeToString(random[8:]),
+		ChatIds:   chatIds,
+		CreatedAt: time.Now(),
+	}
+
+	if ttl != 0 {
+		key.ExpiresAt = key.CreatedAt.Add(ttl)
+	}
+
+	return key, nil
+}
+
+// Handler is a function which rejects requests which are not
+// authenticated with 403. Requests signed with API key are allowed to
+// access its chats only.
+func (a *Auth) Handler(ctx *fiber.Ctx) error {
+	if keyId := ctx.Get(HeaderKeyId); keyId != "" {
+		key, err := a.store.GetAPIKey(keyId)
+		if err != nil {
+			if !errors.Is(err, database.ErrUnknownAPIKey) {
+				return ctx.Status(500).SendString(err.Error())
+			}
+
+			return reject(ctx, err)
+		}
+
+		if !key.ExpiresAt.IsZero() && !time.Now().Before(key.ExpiresAt) {
+			return reject(ctx, errExpiredKey)
+		}
+
+		err = a.verify(ctx, [][]byte{[]byte(key.Secret)})
+		if err != nil {
+			return reject(ctx, err)
+		}
+
+		ctx.Locals(scopeLocal, key.ChatIds)
+		ctx.Locals(signedLocal, true)
+
+		return ctx.Next()
+	}
+
+	if a.legacyEnabled && a.legacy(ctx.Query("key")) {
+		return ctx.Next()
+	}
+
+	if len(a.keys) != 0 {
+		err := a.verify(ctx, a.keys)
+		if err != nil {
+			return reject(ctx, err)
+		}
+
+		ctx.Locals(signedLocal, true)
+
+		return ctx.Next()
+	}
+
+	if a.legacyEnabled {
+		return reject(ctx, errBadKey)
+	}
+
+	// Nothing is configured, so requests are open until first API key
+	// is created
+	keys, err := a.store.GetAPIKeys(0)
+	if err != nil {
+		return ctx.Status(500).SendString(err.Error())
+	}
+
+	if len(keys) != 0 {
+		return reject(ctx, errNoSignature)
+	}
+
+	return ctx.Next()
+}
+
+// Signing is a function which reports whether requests can be signed:
+// there are global keys or API keys in store
+func (a *Auth) Signing() (bool, error) {
+	if len(a.keys) != 0 {
+		return true, nil
+	}
+
+	keys, err := a.store.GetAPIKeys(0)
+	if err != nil {
+		return false, err
+	}
+
+	return len(keys) != 0, nil
+}
+
+// signed is a function which reports whether request is signed with
+// global or API key
+func signed(ctx *fiber.Ctx) bool {
+	signed, _ := ctx.Locals(signedLocal).(bool)
+	return signed
+}
+
+// inScope is a function which reports whether authenticated request is
+// allowed to access chatId
+func inScope(ctx *fiber.Ctx, chatId int64) bool {
+	scope, scoped := ctx.Locals(scopeLocal).([]int64)
+	return !scoped || slices.Contains(scope, chatId)
+}
+
+// scoped is a function which reports whether request is authenticated
+// with API key, which is scoped to its chats
+func scoped(ctx *fiber.Ctx) bool {
+	_, scoped := ctx.Locals(scopeLocal).([]int64)
+	return scoped
+}
+
+// reject is a function which responds 403 to request, reason is logged
+func reject(ctx *fiber.Ctx, reason error) error {
+	slog.Debug(
+		"Request rejected",
+		slog.String("path", ctx.Path()),
+		slog.String("ip", ctx.IP()),
+		slog.String("reason", reason.Error()),
+	)
+
+	return ctx.SendStatus(403)
+}
+
+// legacy is a function which reports whether query key is legacy key,
+// comparing them in constant time
+func (a *Auth) legacy(query string) bool {
+	return query != "" && subtle.ConstantTimeCompare([]byte(query), []byte(a.legacyKey)) == 1
+}
+
+// Signature errors
+var (
+	errNoSignature  = errors.New("signature headers are missing")
+	errBadTimestamp = errors.New("timestamp is malformed or out of window")
+	errBadSignature = errors.New("signature doesn't match")
+	errReplay       = errors.New("nonce was already used")
+	errExpiredKey   = errors.New("api key is expired")
+	errBadKey       = errors.New("legacy key doesn't match")
+)
+
+// verify is a function which checks request signature made with one of
+// keys, timestamp and nonce. Nonce is used only if signature is valid,
+// so it can't be burned by forged requests.
+func (a *Auth) verify(ctx *fiber.Ctx, keys [][]byte) error {
+	header := ctx.Get(HeaderTimestamp)
+	nonce := ctx.Get(HeaderNonce)
+	signature := ctx.Get(HeaderSignature)
+
+	if header == "" || nonce == "" || signature == "" {
+		return errNoSignature
+	}
+
+	timestamp, err := strconv.ParseInt(header, 10, 64)
+	if err != nil {
+		return errBadTimestamp
+	}
+
+	now := time.Now()
+	sent := time.Unix(timestamp, 0)
+
+	if sent.Before(now.Add(-a.window)) || sent.After(now.Add(a.window)) {
+		return errBadTimestamp
+	}
+
+	signed := false
+
+	// Every key is checked, so time doesn't tell which one matched
+	for _, key := range keys {
+		expected := Sign(key, timestamp, nonce, ctx.Method(), ctx.OriginalURL(), ctx.Body())
+		if hmac.Equal([]byte(expected), []byte(signature)) {
+			signed = true
+		}
+	}
+
+	if !signed {
+		return errBadSignature
+	}
+
+	if !a.use(nonce, sent.Add(a.window), now) {
+		return errReplay
+	}
+
+	return nil
+}
+
+// use is a function which remembers nonce until expires, returns false
+// if it was already used
+func (a *Auth) use(nonce string, expires, now time.Time) bool {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	if until, exists := a.nonces[nonce]; exists && now.Before(until) {
+		return false
+	}
+
+	a.nonces[nonce] = expires
+
+	if len(a.nonces) >= a.sweepAt {
+		for key, until := range a.nonces {
+			if !now.Before(until) {
+				delete(a.nonces, key)
+			}
+		}
+
+		// Cache is swept when it doubles, so sweeps are amortized
+		a.sweepAt = 2 * len(a.nonces)
+		if a.sweepAt < nonceSweep {
+			a.sweepAt = nonceSweep
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,116 @@
+package webserver
+
+import (
+	"github.com/xbt573/flood-social-rep/database"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSignedRequestLine(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// signed is method and uri request is signed with
+		signedMethod string
+		signedURI    string
+
+		method string
+		uri    string
+		want   int
+	}{
+		{"signed", "GET", "/audit?chat_id=1", "GET", "/audit?chat_id=1", 200},
+		{"other query", "GET", "/audit?chat_id=1", "GET", "/audit?chat_id=2", 403},
+		{"query added", "GET", "/audit", "GET", "/audit?chat_id=2", 403},
+		{"other path", "POST", "/reactions", "POST", "/reactions/batch", 403},
+		{"other method", "POST", "/audit?chat_id=1", "GET", "/audit?chat_id=1", 403},
+	}
+
+	key := []byte("key")
+	store := database.NewMemory(database.DefaultRegistry())
+	app := New(store, NewAuth(store, []string{string(key)}, DefaultWindow, "", false), nil)
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			timestamp := time.Now().Unix()
+			nonce := strconv.Itoa(i)
+
+			request := httptest.NewRequest(test.method, test.uri, nil)
+			request.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+			request.Header.Set(HeaderNonce, nonce)
+			request.Header.Set(HeaderSignature, Sign(key, timestamp, nonce, test.signedMethod, test.signedURI, nil))
+
+			response, err := app.Test(request, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if response.StatusCode != test.want {
+				t.Errorf("status = %v, want %v", response.StatusCode, test.want)
+			}
+		})
+	}
+}
+
+// Audit log is read with signed requests only, API keys read chats of
+// their scope only
+func TestAuditAccess(t *testing.T) {
+	key := []byte("key")
+
+	apiKey, err := NewAPIKey([]int64{1}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	open := database.NewMemory(database.DefaultRegistry())
+
+	signed := database.NewMemory(database.DefaultRegistry())
+	err = signed.AddAPIKey(apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		auth  *Auth
+		keyId string
+		key   []byte
+		uri   string
+		want  int
+	}{
+		{"open", NewAuth(open, nil, DefaultWindow, "", false), "", nil, "/audit", 404},
+		{"legacy only", NewAuth(open, nil, DefaultWindow, "legacy", true), "", nil, "/audit?key=legacy", 404},
+		{"legacy", NewAuth(open, []string{string(key)}, DefaultWindow, "legacy", true), "", nil, "/audit?key=legacy", 403},
+		{"global key", NewAuth(open, []string{string(key)}, DefaultWindow, "", false), "", key, "/audit", 200},
+		{"api key", NewAuth(signed, nil, DefaultWindow, "", false), apiKey.Id, []byte(apiKey.Secret), "/audit?chat_id=1", 200},
+		{"api key all chats", NewAuth(signed, nil, DefaultWindow, "", false), apiKey.Id, []byte(apiKey.Secret), "/audit", 403},
+		{"api key other chat", NewAuth(signed, nil, DefaultWindow, "", false), apiKey.Id, []byte(apiKey.Secret), "/audit?chat_id=2", 403},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := New(test.auth.store, test.auth, nil)
+			request := httptest.NewRequest("GET", test.uri, nil)
+
+			if test.key != nil {
+				timestamp := time.Now().Unix()
+				nonce := strconv.Itoa(i)
+
+				request.Header.Set(HeaderKeyId, test.keyId)
+				request.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+				request.Header.Set(HeaderNonce, nonce)
+				request.Header.Set(HeaderSignature, Sign(test.key, timestamp, nonce, "GET", test.uri, nil))
+			}
+
+			response, err := app.Test(request, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if response.StatusCode != test.want {
+				t.Errorf("status = %v, want %v", response.StatusCode, test.want)
+			}
+		})
+	}
+}
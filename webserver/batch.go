@@ -0,0 +1,96 @@
+package webserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// batchMax is a maximum number of requests in batch
+const batchMax = 1000
+
+// errOutOfScope is an error of request for chat out of API key scope
+var errOutOfScope = errors.New("chat is out of api key scope")
+
+// batchResult is a result of batch request
+type batchResult struct {
+	// Ok reports whether request was applied
+	Ok bool `json:"ok"`
+
+	// Error is a reason request was not applied
+	Error string `json:"error,omitempty"`
+}
+
+// batchReport is a response to batch
+type batchReport struct {
+	// Committed reports whether batch was committed, atomic batch is
+	// rolled back if any of its requests fails
+	Committed bool `json:"committed"`
+
+	// Applied is a number of applied requests
+	Applied int `json:"applied"`
+
+	// Failed is a number of failed requests
+	Failed int `json:"failed"`
+
+	// Results are results of requests in order they were sent
+	Results []batchResult `json:"results"`
+}
+
+// parseBatch is a function which splits body (JSON array or newline
+// delimited JSON) into requests, they are parsed one by one later, so
+// malformed request fails alone
+func parseBatch(body []byte) ([]json.RawMessage, error) {
+	body = bytes.TrimSpace(body)
+
+	if bytes.HasPrefix(body, []byte("[")) {
+		var items []json.RawMessage
+
+		err := json.Unmarshal(body, &items)
+		if err != nil {
+			return nil, err
+		}
+
+		return items, nil
+	}
+
+	var items []json.RawMessage
+
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		items = append(items, json.RawMessage(line))
+	}
+
+	return items, nil
+}
+
+// newBatchReport is a function which builds report of batch from errors
+// of its requests
+func newBatchReport(errs []error, committed bool) batchReport {
+	report := batchReport{
+		Committed: committed,
+		Results:   make([]batchResult, len(errs)),
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			report.Failed++
+			report.Results[i].Error = err.Error()
+			continue
+		}
+
+		report.Applied++
+		report.Results[i].Ok = true
+	}
+
+	// Nothing is applied if batch is rolled back
+	if !committed {
+		report.Applied = 0
+	}
+
+	return report
+}
@@ -0,0 +1,56 @@
+package webserver
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/xbt573/flood-social-rep/database"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// Concurrent /reactions posts into SQLite store
+func BenchmarkPostReactions(b *testing.B) {
+	store, err := database.NewSQLite(filepath.Join(b.TempDir(), "bench.db"), database.DefaultRegistry())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer store.Close()
+
+	err = store.SetRateLimit(-1001, database.RateLimit{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	app := New(store, NewAuth(store, nil, DefaultWindow, "", false), nil)
+
+	var messageId atomic.Int64
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := messageId.Add(1)
+			body := fmt.Sprintf(
+				`{"chat":{"id":-1001},"message_id":%d,"from_user":{"id":%d,"first_name":"A"},`+
+					`"reactions":[{"emoji":"👍","from":{"id":%d}},{"emoji":"🔥","from":{"id":%d}}]}`,
+				id, id%50+1, id%100+1000, id%100+2000,
+			)
+
+			request := httptest.NewRequest("POST", "/reactions", bytes.NewBufferString(body))
+			request.Header.Set("Content-Type", "application/json")
+
+			response, err := app.Test(request, -1)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+
+			if response.StatusCode != 200 {
+				b.Errorf("status = %v", response.StatusCode)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package webserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// CaptureRecord is a captured request
+type CaptureRecord struct {
+	// ReceivedAt is a time request was received at
+	ReceivedAt time.Time `json:"received_at"`
+
+	// Status is a response status code
+	Status int `json:"status"`
+
+	// Error is a reason request failed with
+	Error string `json:"error,omitempty"`
+
+	// Request is a request body, unless it's not JSON
+	Request json.RawMessage `json:"request,omitempty"`
+
+	// Raw is a request body which is not JSON
+	Raw string `json:"raw,omitempty"`
+}
+
+// Capture is a JSONL file requests are appended to. File is rotated
+// when it grows over maxSize: it's renamed to path.1, path.1 to path.2
+// and so on, files older than keep rotations are removed.
+type Capture struct {
+	path    string
+	maxSize int64
+	keep    int
+
+	// file is a current capture file, size is its size
+	file *os.File
+	size int64
+
+	// mux is sync.Mutex which is locked where file is written
+	mux sync.Mutex
+}
+
+// NewCapture is a function which opens capture file at path for
+// appending, it's rotated at maxSize bytes with keep old files kept
+func NewCapture(path string, maxSize int64, keep int) (*Capture, error) {
+	c := &Capture{path: path, maxSize: maxSize, keep: keep}
+
+	err := c.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Handler is a function which captures request body with outcome of
+// handlers after it
+func (c *Capture) Handler(ctx *fiber.Ctx) error {
+	record := CaptureRecord{ReceivedAt: time.Now()}
+
+	err := ctx.Next()
+
+	record.Status = ctx.Response().StatusCode()
+
+	switch {
+	case err != nil:
+		// Error is turned into response after handlers, so status is
+		// the one error handler is going to respond with
+		record.Status = fiber.StatusInternalServerError
+		record.Error = err.Error()
+
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			record.Status = fiberErr.Code
+		}
+
+	case record.Status >= 400:
+		record.Error = string(ctx.Response().Body())
+	}
+
+	body := ctx.Body()
+	if json.Valid(body) {
+		record.Request = body
+	} else {
+		record.Raw = string(body)
+	}
+
+	// Failing capture doesn't fail request
+	captureErr := c.Write(record)
+	if captureErr != nil {
+		slog.Error(
+			"Failed capturing request!",
+			slog.String("err", captureErr.Error()),
+		)
+	}
+
+	return err
+}
+
+// Write is a function which appends record to capture file, file is
+// rotated first if record doesn't fit in it
+func (c *Capture) Write(record CaptureRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	line = append(line, '\n')
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.size > 0 && c.size+int64(len(line)) > c.maxSize {
+		err := c.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := c.file.Write(line)
+	c.size += int64(n)
+
+	return err
+}
+
+// Close is a function which closes capture file
+func (c *Capture) Close() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.file.Close()
+}
+
+// open is a function which opens capture file for appending
+func (c *Capture) open() error {
+	file, err := os.OpenFile(c.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	c.file = file
+	c.size = info.Size()
+
+	return nil
+}
+
+// rotate is a function which shifts old capture files and starts new
+// one, capture file is reopened even if shifting fails
+func (c *Capture) rotate() error {
+	err := c.file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = c.shift()
+	openErr := c.open()
+
+	if err != nil {
+		return err
+	}
+
+	return openErr
+}
+
+// shift is a function which renames path.n to path.n+1 and path to
+// path.1, the oldest file is removed
+func (c *Capture) shift() error {
+	if c.keep == 0 {
+		return os.Remove(c.path)
+	}
+
+	err := os.Remove(fmt.Sprintf("%v.%v", c.path, c.keep))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	for i := c.keep - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%v.%v", c.path, i), fmt.Sprintf("%v.%v", c.path, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return os.Rename(c.path, c.path+".1")
+}
@@ -0,0 +1,89 @@
+package webserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/xbt573/flood-social-rep/database"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Reactions requests are captured with their status, including ones
+// rejected by authentication
+func TestCaptureRejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+
+	capture, err := NewCapture(path, 1024*1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer capture.Close()
+
+	key := []byte("key")
+	store := database.NewMemory(database.DefaultRegistry())
+	app := New(store, NewAuth(store, []string{string(key)}, DefaultWindow, "", false), capture)
+
+	body := []byte(`{"chat":{"id":-1001},"message_id":1,"from_user":{"id":1,"first_name":"A"},"reactions":[]}`)
+
+	tests := []struct {
+		name   string
+		signed bool
+		want   int
+	}{
+		{"unsigned", false, 403},
+		{"signed", true, 200},
+	}
+
+	for i, test := range tests {
+		request := httptest.NewRequest("POST", "/reactions", bytes.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+
+		if test.signed {
+			timestamp := time.Now().Unix()
+			nonce := strconv.Itoa(i)
+
+			request.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+			request.Header.Set(HeaderNonce, nonce)
+			request.Header.Set(HeaderSignature, Sign(key, timestamp, nonce, "POST", "/reactions", body))
+		}
+
+		response, err := app.Test(request, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if response.StatusCode != test.want {
+			t.Fatalf("%v: status = %v, want %v", test.name, response.StatusCode, test.want)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for _, test := range tests {
+		if !scanner.Scan() {
+			t.Fatalf("%v: request is not captured", test.name)
+		}
+
+		var record CaptureRecord
+
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if record.Status != test.want || !bytes.Equal(record.Request, body) {
+			t.Errorf("%v: captured %+v, want status %v with request body", test.name, record, test.want)
+		}
+	}
+}
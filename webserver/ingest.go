@@ -0,0 +1,122 @@
+package webserver
+
+import (
+	"github.com/xbt573/flood-social-rep/database"
+	"github.com/xbt573/flood-social-rep/models"
+	"github.com/xbt573/flood-social-rep/names"
+	"time"
+)
+
+// IngestResult is a change request made to store
+type IngestResult struct {
+	// Added is a number of reactions stored
+	Added int
+
+	// Removed is a number of reactions taken back
+	Removed int
+
+	// Skipped is a number of request reactions which are not stored:
+	// own reactions, reactions of ignored users, rate limited ones
+	Skipped int
+}
+
+// givenReaction is a reaction of user to message
+type givenReaction struct {
+	userId   int64
+	reaction string
+}
+
+// Ingest is a function which applies forwarder request received at time
+// to store. Request reactions are the full current state of message, so
+// stored reactions missing from it were taken back.
+func Ingest(store database.Store, request models.Request, at time.Time) (IngestResult, error) {
+	var result IngestResult
+
+	stored, err := store.GetReactions(request.Chat.Id, request.MessageId)
+	if err != nil {
+		return result, err
+	}
+
+	for _, old := range stored {
+		removed := true
+
+		for _, reaction := range request.Reactions {
+			key := database.ReactionKey(reaction.Emoji, reaction.CustomEmojiId)
+			if reaction.From.Id == old.UserId && key == old.Reaction {
+				removed = false
+				break
+			}
+		}
+
+		if !removed {
+			continue
+		}
+
+		err := store.RemoveReaction(
+			request.Chat.Id,
+			old.UserId,
+			request.MessageId,
+			old.Reaction,
+		)
+		if err != nil {
+			return result, err
+		}
+
+		result.Removed++
+	}
+
+	err = store.AddName(
+		request.Chat.Id,
+		request.FromUser.Id,
+		request.FromUser.Username,
+		names.FullName(request.FromUser.FirstName, request.FromUser.LastName),
+		at,
+	)
+	if err != nil {
+		return result, err
+	}
+
+	for _, reaction := range request.Reactions {
+		err := store.AddReaction(
+			request.Chat.Id,
+			reaction.From.Id,
+			request.FromUser.Id,
+			request.MessageId,
+			database.ReactionKey(reaction.Emoji, reaction.CustomEmojiId),
+			at,
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// Reactions are stored or not for many reasons, so result is
+	// counted from message reactions after request
+	current, err := store.GetReactions(request.Chat.Id, request.MessageId)
+	if err != nil {
+		return result, err
+	}
+
+	before := map[givenReaction]bool{}
+	for _, reaction := range stored {
+		before[givenReaction{reaction.UserId, reaction.Reaction}] = true
+	}
+
+	after := map[givenReaction]bool{}
+	for _, reaction := range current {
+		after[givenReaction{reaction.UserId, reaction.Reaction}] = true
+
+		if !before[givenReaction{reaction.UserId, reaction.Reaction}] {
+			result.Added++
+		}
+	}
+
+	for _, reaction := range request.Reactions {
+		key := database.ReactionKey(reaction.Emoji, reaction.CustomEmojiId)
+		if !after[givenReaction{reaction.From.Id, key}] {
+			result.Skipped++
+		}
+	}
+
+	return result, nil
+}
@@ -2,56 +2,169 @@
 package webserver
 
 import (
+	"encoding/json"
+	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/xbt573/flood-social-rep/database"
 	"github.com/xbt573/flood-social-rep/models"
+	"golang.org/x/exp/slog"
+	"time"
 )
 
-// New is a function for creating webserver instance
-func New(key string, keyEnabled bool) *fiber.App {
+// New is a function for creating webserver instance, requests are
+// authenticated with auth. Reactions requests are captured if capture
+// is not nil. Audit log is served only if requests can be signed.
+func New(store database.Store, auth *Auth, capture *Capture) *fiber.App {
 	app := fiber.New(fiber.Config{
 		// Remove this fucking fancy banner
 		DisableStartupMessage: true,
 	})
 
+	// Reactions requests are captured before authentication, so
+	// rejected ones are recorded with their status too
+	if capture != nil {
+		app.Post("/reactions", capture.Handler)
+	}
+
+	app.Use(auth.Handler)
+
 	app.Post("/reactions", func(ctx *fiber.Ctx) error {
-		if query := ctx.Query("key"); query != key && keyEnabled {
-			return ctx.SendStatus(403)
-		}
 		var request models.Request
 
 		if err := ctx.BodyParser(&request); err != nil {
 			return err
 		}
 
-		for _, reaction := range request.Reactions {
-			err := database.AddReaction(
-				request.Chat.Id,
-				reaction.From.Id,
-				request.FromUser.Id,
-				request.MessageId,
-				reaction.Emoji,
-			)
-			if err != nil {
-				return ctx.Status(500).SendString(err.Error())
-			}
+		if !inScope(ctx, request.Chat.Id) {
+			return ctx.Status(403).SendString(errOutOfScope.Error())
+		}
+
+		_, err := Ingest(store, request, time.Now())
+		if err != nil {
+			return ctx.Status(500).SendString(err.Error())
+		}
 
-			username := request.FromUser.Username
-			if username == "" {
-				username = request.FromUser.FirstName
-				if request.FromUser.LastName != "" {
-					username = username + " " + request.FromUser.LastName
+		return nil
+	})
+
+	// Batch of requests as JSON array or newline delimited JSON, applied
+	// in single transaction. Failed requests are skipped, unless atomic
+	// query parameter makes them roll back whole batch.
+	app.Post("/reactions/batch", func(ctx *fiber.Ctx) error {
+		items, err := parseBatch(ctx.Body())
+		if err != nil {
+			return ctx.Status(400).SendString(err.Error())
+		}
+
+		if len(items) > batchMax {
+			return ctx.Status(413).SendString("too many requests in batch")
+		}
+
+		batch := make([]database.BatchItem, len(items))
+
+		for i, item := range items {
+			item := item
+
+			batch[i] = func(store database.Store) error {
+				var request models.Request
+
+				err := json.Unmarshal(item, &request)
+				if err != nil {
+					return err
+				}
+
+				if !inScope(ctx, request.Chat.Id) {
+					return errOutOfScope
 				}
-			}
 
-			err = database.UpdateUsername(request.FromUser.Id, username)
-			if err != nil {
-				return ctx.Status(500).SendString(err.Error())
+				_, err = Ingest(store, request, time.Now())
+				return err
 			}
 		}
 
-		return nil
+		errs, err := store.Batch(batch, database.BatchOpts{Atomic: ctx.QueryBool("atomic")})
+		if err != nil && !errors.Is(err, database.ErrBatchAborted) {
+			return ctx.Status(500).SendString(err.Error())
+		}
+
+		report := newBatchReport(errs, err == nil)
+		if !report.Committed {
+			ctx.Status(422)
+		}
+
+		return ctx.JSON(report)
+	})
+
+	signing, err := auth.Signing()
+	if err != nil {
+		slog.Error(
+			"Failed checking API keys, audit log is not served!",
+			slog.String("err", err.Error()),
+		)
+	}
+
+	if !signing {
+		return app
+	}
+
+	// Audit log pages, most recent first: next page is requested with
+	// before set to next_before of previous one. Only signed requests
+	// are served, and only global keys can read all chats at once.
+	app.Get("/audit", func(ctx *fiber.Ctx) error {
+		var params struct {
+			ChatId int64 `query:"chat_id"`
+			Before int64 `query:"before"`
+			Limit  int   `query:"limit"`
+		}
+
+		if err := ctx.QueryParser(&params); err != nil {
+			return ctx.Status(400).SendString(err.Error())
+		}
+
+		if !signed(ctx) {
+			return ctx.Status(403).SendString(errNotSigned.Error())
+		}
+
+		if !inScope(ctx, params.ChatId) || params.ChatId == 0 && scoped(ctx) {
+			return ctx.Status(403).SendString(errOutOfScope.Error())
+		}
+
+		if params.Limit <= 0 || params.Limit > auditMax {
+			params.Limit = auditMax
+		}
+
+		entries, err := store.GetAudit(params.ChatId, params.Before, params.Limit)
+		if err != nil {
+			return ctx.Status(500).SendString(err.Error())
+		}
+
+		page := auditPage{Entries: entries}
+		if len(entries) == params.Limit {
+			page.NextBefore = entries[len(entries)-1].Id
+		}
+
+		if page.Entries == nil {
+			page.Entries = []models.AuditEntry{}
+		}
+
+		return ctx.JSON(page)
 	})
 
 	return app
 }
+
+// auditMax is a maximum number of entries in audit log page
+const auditMax = 100
+
+// errNotSigned is an error of audit log request which is not signed
+// with global or API key
+var errNotSigned = errors.New("audit log requests must be signed")
+
+// auditPage is a page of audit log
+type auditPage struct {
+	// Entries are page entries, most recent first
+	Entries []models.AuditEntry `json:"entries"`
+
+	// NextBefore is a before of next page, zero if there is no next page
+	NextBefore int64 `json:"next_before,omitempty"`
+}